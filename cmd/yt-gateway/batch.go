@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/gateway"
+)
+
+// runPlaylist processes every video of a playlist and returns the exit code.
+func runPlaylist(gw *gateway.Service, rawURL string, opts gateway.Options, workers int, out *output) int {
+	// Ctrl+C lets the running videos finish and skips the rest
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	p, items, err := gw.ProcessPlaylist(ctx, rawURL, opts, workers)
+	if err != nil {
+		slog.Error("Failed to read playlist", "err", err)
+		out.fail(rawURL, err)
+		return 1
+	}
+	slog.Info("Processing playlist via CLI", "title", p.Title, "videos", len(p.VideoIDs), "workers", workers)
+	code := runBatch(items, out)
+	if p.Truncated {
+		slog.Warn("Playlist truncated: YouTube only lists the first videos, the rest were not processed", "processed", len(p.VideoIDs))
+	}
+	return code
+}
+
+// runURLs processes a list of URLs and returns the exit code.
+func runURLs(gw *gateway.Service, urls []string, opts gateway.Options, workers int, out *output) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	slog.Info("Processing batch via CLI", "videos", len(urls), "workers", workers)
+	return runBatch(gw.ProcessBatch(ctx, urls, opts, workers), out)
+}
+
+// readBatch reads one URL per line from a file ("-" = stdin). Blank lines and lines starting
+// with "#" are ignored, as is text after the URL (chat exports often add notes).
+func readBatch(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+
+	var urls []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) > 0 && !strings.HasPrefix(fields[0], "#") {
+			urls = append(urls, fields[0])
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no URLs in %s", name)
+	}
+	return urls, nil
+}
+
+// runBatch reports the items as they finish, then prints a summary of all of them.
+// It returns 1 if any item failed.
+func runBatch(items <-chan gateway.BatchItem, out *output) int {
+	var summary gateway.BatchSummary
+	var done []gateway.BatchItem
+	for item := range items {
+		item.Err = out.result(item)
+		summary.Add(item)
+		done = append(done, item)
+	}
+
+	sort.Slice(done, func(i, j int) bool { return done[i].Index < done[j].Index })
+	for _, item := range done {
+		if item.Err != nil {
+			slog.Error("FAILED", "item", item.Index+1, "url", item.URL, "err", item.Err)
+		} else {
+			slog.Info("OK", "item", item.Index+1, "url", item.URL, "title", item.Result.Title, "path", item.Path)
+		}
+	}
+	slog.Info("Batch finished", "total", summary.Total, "succeeded", summary.Succeeded, "failed", summary.Failed)
+
+	if summary.Failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/imbecility/yt-gateway/pkg/client"
+	"github.com/imbecility/yt-gateway/pkg/ffmpeg"
+	"github.com/imbecility/yt-gateway/pkg/gateway"
+	"github.com/imbecility/yt-gateway/pkg/logger"
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/providers"
+	"github.com/imbecility/yt-gateway/pkg/utils"
+)
+
+// defaultTestVideo is the video the providers command tests with ("Me at the zoo").
+const defaultTestVideo = "https://www.youtube.com/watch?v=jNQXAC9IVRw"
+
+// newClient sets up logging and the HTTP client for the commands that don't need a gateway.
+// With asJSON the logs go to stderr, leaving stdout to the document.
+func newClient(debug, asJSON bool) (providers.HTTPClient, error) {
+	var w io.Writer = os.Stdout
+	if asJSON {
+		w = os.Stderr
+	}
+	logger.SetupGlobalTo(w, debug, false)
+	return client.NewHttpClient()
+}
+
+// printJSON writes v to stdout as one line of JSON.
+func printJSON(v any) int {
+	if err := json.NewEncoder(os.Stdout).Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// withTimeout runs fn and reports whether it finished within d.
+// fn keeps running in the background after a timeout.
+func withTimeout(d time.Duration, fn func()) bool {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+func cmdInfo(args []string) int {
+	fs := newFlagSet("info")
+	debug := fs.Bool("debug", false, "Enable debug logging")
+	asJSON := fs.Bool("json", false, "Print the metadata as JSON")
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	vidID := utils.ExtractVideoID(fs.Arg(0))
+	if vidID == "" {
+		fmt.Fprintln(os.Stderr, "Could not extract video ID")
+		return 1
+	}
+	c, err := newClient(*debug, *asJSON)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	md, err := providers.GetVideoMetadata(c, vidID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to fetch metadata: %v\n", err)
+		return 1
+	}
+	if *asJSON {
+		return printJSON(struct {
+			VideoID string `json:"video_id"`
+			*models.VideoMetadata
+		}{vidID, md})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%s\n", vidID)
+	fmt.Fprintf(w, "Title:\t%s\n", md.Title)
+	fmt.Fprintf(w, "Channel:\t%s %s\n", md.Channel, md.ChannelURL)
+	fmt.Fprintf(w, "Uploaded:\t%s\n", md.UploadDate)
+	fmt.Fprintf(w, "Duration:\t%s\n", utils.FormatTimestamp(md.DurationSec))
+	fmt.Fprintf(w, "Views:\t%d\n", md.ViewCount)
+	fmt.Fprintf(w, "Live:\t%s\n", yesNo(md.IsLive))
+	fmt.Fprintf(w, "Short:\t%s\n", yesNo(md.IsShort))
+	fmt.Fprintf(w, "Age restricted:\t%s\n", yesNo(md.AgeRestricted))
+	fmt.Fprintf(w, "Thumbnail:\t%s\n", md.ThumbnailURL)
+	_ = w.Flush()
+
+	if len(md.Chapters) > 0 {
+		fmt.Println("Chapters:")
+		for _, ch := range md.Chapters {
+			fmt.Printf("  %8s  %s\n", utils.FormatTimestamp(ch.StartSec), ch.Title)
+		}
+	}
+	return 0
+}
+
+func cmdFormats(args []string) int {
+	fs := newFlagSet("formats")
+	debug := fs.Bool("debug", false, "Enable debug logging")
+	timeout := fs.Int("timeout", 60, "Max seconds to wait for each provider")
+	showURLs := fs.Bool("urls", false, "Also print the stream URLs")
+	asJSON := fs.Bool("json", false, "Print the formats as a JSON array (with URLs)")
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	c, err := newClient(*debug, *asJSON)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	type listing struct {
+		name    string
+		formats []models.Format
+		err     error
+	}
+	var listings []*listing
+	var wg sync.WaitGroup
+	for _, p := range gateway.DefaultProviders(c) {
+		lister, ok := p.(providers.FormatLister)
+		if !ok {
+			continue
+		}
+		l := &listing{name: p.Name()}
+		listings = append(listings, l)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var formats []models.Format
+			var ferr error
+			if !withTimeout(time.Duration(*timeout)*time.Second, func() { formats, ferr = lister.Formats(fs.Arg(0)) }) {
+				ferr = errors.New("timed out")
+			}
+			l.formats, l.err = formats, ferr
+		}()
+	}
+	wg.Wait()
+
+	if *asJSON {
+		type providerFormat struct {
+			Provider string `json:"provider"`
+			models.Format
+		}
+		all := []providerFormat{}
+		for _, l := range listings {
+			if l.err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", l.name, l.err)
+			}
+			for _, f := range l.formats {
+				all = append(all, providerFormat{l.name, f})
+			}
+		}
+		if len(all) == 0 {
+			fmt.Fprintln(os.Stderr, "No provider listed any formats")
+			return 1
+		}
+		return printJSON(all)
+	}
+
+	found := false
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROVIDER\tEXT\tQUALITY\tHEIGHT\tVIDEO\tAUDIO\tSIZE")
+	for _, l := range listings {
+		if l.err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", l.name, l.err)
+			continue
+		}
+		for _, f := range l.formats {
+			found = true
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", l.name, f.Extension, f.Quality, orDash(f.Height > 0, fmt.Sprint(f.Height)),
+				yesNo(f.HasVideo), yesNo(f.HasAudio), orDash(f.SizeBytes > 0, fmt.Sprintf("%.1f MB", float64(f.SizeBytes)/1024/1024)))
+			if *showURLs {
+				fmt.Fprintf(w, "\t%s\n", f.URL)
+			}
+		}
+	}
+	_ = w.Flush()
+
+	if !found {
+		fmt.Fprintln(os.Stderr, "No provider listed any formats")
+		return 1
+	}
+	return 0
+}
+
+func cmdProviders(args []string) int {
+	fs := newFlagSet("providers")
+	debug := fs.Bool("debug", false, "Enable debug logging")
+	testURL := fs.String("url", defaultTestVideo, "Video to test the providers with")
+	timeout := fs.Int("timeout", 60, "Max seconds to wait for each provider")
+	parseFlags(fs, args)
+
+	c, err := newClient(*debug, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	type probe struct {
+		name    string
+		formats bool
+		res     *models.VideoResult
+		err     error
+		elapsed time.Duration
+	}
+	provs := gateway.DefaultProviders(c)
+	probes := make([]*probe, len(provs))
+	var wg sync.WaitGroup
+	for i, p := range provs {
+		_, lists := p.(providers.FormatLister)
+		pr := &probe{name: p.Name(), formats: lists}
+		probes[i] = pr
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			var res *models.VideoResult
+			var gerr error
+			if !withTimeout(time.Duration(*timeout)*time.Second, func() { res, gerr = p.GetLink(*testURL) }) {
+				gerr = errors.New("timed out")
+			}
+			pr.res, pr.err, pr.elapsed = res, gerr, time.Since(start).Round(time.Millisecond)
+		}()
+	}
+	wg.Wait()
+
+	working := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROVIDER\tSTATUS\tTIME\tFORMATS\tDETAILS")
+	for _, pr := range probes {
+		if pr.err != nil {
+			fmt.Fprintf(w, "%s\tFAIL\t%s\t%s\t%v\n", pr.name, pr.elapsed, yesNo(pr.formats), pr.err)
+			continue
+		}
+		working++
+		details := pr.res.Extension
+		if pr.res.NeedsMuxing {
+			details += ", separate audio"
+		}
+		fmt.Fprintf(w, "%s\tOK\t%s\t%s\t%s\n", pr.name, pr.elapsed, yesNo(pr.formats), details)
+	}
+	_ = w.Flush()
+
+	if working == 0 {
+		return 1
+	}
+	return 0
+}
+
+// doctorFeatures are the optional features and what they need beyond remuxing.
+var doctorFeatures = []struct {
+	name     string
+	encoders []string
+	filters  []string
+}{
+	{"accurate clips (-accurate)", []string{"libx264", "aac"}, nil},
+	{"thumbnails from video (-thumb)", []string{"mjpeg"}, nil},
+	{"contact sheets (-contact-sheet)", []string{"mjpeg"}, []string{"fps", "scale", "tile"}},
+	{"GIF export (-anim gif)", []string{"gif"}, []string{"fps", "scale", "split", "palettegen", "paletteuse"}},
+	{"WebP export (-anim webp)", []string{"libwebp"}, []string{"fps", "scale"}},
+	{"embedded subtitles (-subs-embed)", []string{"mov_text"}, nil},
+	{"burned-in subtitles (-subs-burn)", []string{"libx264"}, []string{"subtitles"}},
+}
+
+func cmdDoctor(args []string) int {
+	fs := newFlagSet("doctor")
+	ffmpegPath := fs.String("ffmpeg", "ffmpeg", "Path to ffmpeg binary")
+	outDir := fs.String("out", "./downloads", "Output directory")
+	timeout := fs.Int("timeout", 10, "Max seconds to wait for each host")
+	parseFlags(fs, args)
+
+	failed := false
+	check := func(status, subject, detail string) {
+		if status == "FAIL" {
+			failed = true
+		}
+		fmt.Printf("[%-4s] %s: %s\n", status, subject, detail)
+	}
+
+	// ffmpeg: a missing binary is only a warning, the gateway downloads the nano build on start
+	if out, err := exec.Command(*ffmpegPath, "-version").Output(); err != nil {
+		check("WARN", "ffmpeg", fmt.Sprintf("%s not usable (%v), the nano build will be downloaded on start", *ffmpegPath, err))
+	} else {
+		version, _, _ := strings.Cut(string(out), "\n")
+		check("OK", "ffmpeg", version)
+
+		m := &ffmpeg.Muxer{BinaryPath: *ffmpegPath}
+		for _, f := range doctorFeatures {
+			if err := m.Require(f.encoders, f.filters); err != nil {
+				check("WARN", f.name, err.Error())
+			} else {
+				check("OK", f.name, "supported")
+			}
+		}
+	}
+
+	// output directory
+	if err := checkWritable(*outDir); err != nil {
+		check("FAIL", "output directory", err.Error())
+	} else {
+		check("OK", "output directory", *outDir+" is writable")
+	}
+
+	// network
+	c, err := newClient(false, false)
+	if err != nil {
+		check("FAIL", "http client", err.Error())
+		return 1
+	}
+	hosts := []string{"www.youtube.com"}
+	for _, p := range gateway.DefaultProviders(c) {
+		hosts = append(hosts, p.Name())
+	}
+	results := make([]string, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var rerr error
+			start := time.Now()
+			if !withTimeout(time.Duration(*timeout)*time.Second, func() { rerr = reach(c, host) }) {
+				rerr = errors.New("timed out")
+			}
+			if rerr != nil {
+				results[i] = rerr.Error()
+			} else {
+				results[i] = "reachable in " + time.Since(start).Round(time.Millisecond).String()
+			}
+		}()
+	}
+	wg.Wait()
+
+	reachable := 0
+	for i, host := range hosts {
+		if strings.HasPrefix(results[i], "reachable") {
+			reachable++
+			check("OK", host, results[i])
+		} else {
+			check("WARN", host, results[i])
+		}
+	}
+	if reachable == 0 {
+		check("FAIL", "network", "no host is reachable")
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// checkWritable creates dir if needed and writes a temporary file into it.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".doctor_*")
+	if err != nil {
+		return err
+	}
+	_, werr := f.WriteString("ok")
+	cerr := f.Close()
+	_ = os.Remove(f.Name())
+	return errors.Join(werr, cerr)
+}
+
+// reach requests the front page of host; any answer below 500 counts.
+func reach(c providers.HTTPClient, host string) error {
+	req, err := http.NewRequest(http.MethodGet, "https://"+host+"/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// orDash returns s, or "-" when the value is unknown.
+func orDash(known bool, s string) string {
+	if known {
+		return s
+	}
+	return "-"
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// secretFlags are masked by config print.
+var secretFlags = map[string]bool{"api-keys": true, "admin-key": true, "url-secrets": true}
+
+func addConfigFlag(fs *flag.FlagSet) {
+	fs.String(config.ConfigFlag, "", "Config file (default $"+config.FileEnv+", ./yt-gateway.yaml or the user config dir)")
+}
+
+// settingNames returns the flags that can be set in the config file and the environment:
+// the persistent gateway and serve settings. What get processes and how is per-run and only
+// comes from the command line.
+func settingNames() map[string]bool {
+	fs := flag.NewFlagSet("settings", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	addGatewayFlags(fs)
+	addServeFlags(fs)
+	names := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) { names[f.Name] = true })
+	return names
+}
+
+// parseFlags parses args, then fills the settings that weren't given from the YTGW_* environment
+// variables and the config file. Bad settings exit with code 2, like bad flags.
+// It returns the config file used ("" if none) and where each flag's value came from.
+func parseFlags(fs *flag.FlagSet, args []string) (string, map[string]config.Source) {
+	_ = fs.Parse(args)
+
+	path := config.Find(fs.Lookup(config.ConfigFlag).Value.String())
+	settings := settingNames()
+	var values map[string]string
+	if path != "" {
+		var err error
+		if values, err = config.LoadFile(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			os.Exit(2)
+		}
+		if unknown := config.Unknown(values, settings); len(unknown) > 0 {
+			fmt.Fprintf(os.Stderr, "Unknown settings in %s: %s\n", path, strings.Join(unknown, ", "))
+			os.Exit(2)
+		}
+	}
+
+	sources, err := config.Apply(fs, values, settings)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	return path, sources
+}
+
+// cmdConfig runs "config print": the settings get and serve would use, as YAML that can
+// be saved as a config file, each commented with where its value came from.
+func cmdConfig(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		newFlagSet("config").Usage()
+		return 2
+	}
+
+	fs := newFlagSet("config")
+	addGatewayFlags(fs)
+	addServeFlags(fs)
+	path, sources := parseFlags(fs, args[1:])
+
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == config.ConfigFlag {
+			return
+		}
+		value := &yaml.Node{}
+		if secretFlags[f.Name] && f.Value.String() != "" {
+			value.SetString("<hidden>")
+		} else if err := value.Encode(f.Value.(flag.Getter).Get()); err != nil {
+			value.SetString(f.Value.String())
+		}
+		source := sources[f.Name]
+		switch source {
+		case config.SourceEnv:
+			value.LineComment = string(source) + " " + config.EnvName(f.Name)
+		default:
+			value.LineComment = string(source)
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.Name}, value)
+	})
+
+	if path != "" {
+		fmt.Printf("# config file: %s\n", path)
+	} else {
+		fmt.Println("# no config file")
+	}
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	_ = enc.Close()
+	return 0
+}
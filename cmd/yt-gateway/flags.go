@@ -0,0 +1,275 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/imbecility/yt-gateway/pkg/ffmpeg"
+	"github.com/imbecility/yt-gateway/pkg/gateway"
+	"github.com/imbecility/yt-gateway/pkg/storage"
+	"github.com/imbecility/yt-gateway/pkg/utils"
+)
+
+// gatewayFlags configure the gateway itself; get and serve share them.
+type gatewayFlags struct {
+	ffmpegPath    string
+	outDir        string
+	timeout       int
+	debug         bool
+	progress      bool
+	name          string
+	tags          bool
+	maxFileMB     int
+	quotaMB       int
+	maxJobs       int
+	bandwidthKBps int
+	maxDuration   string
+	maxSizeMB     int
+	rejectLive    bool
+	providers     string
+	s3Endpoint    string
+	s3Bucket      string
+	s3Region      string
+	s3Prefix      string
+	// logOutput receives the logs (stdout if nil); not a flag, -json moves them to stderr.
+	logOutput io.Writer
+}
+
+func addGatewayFlags(fs *flag.FlagSet) *gatewayFlags {
+	f := &gatewayFlags{}
+	fs.StringVar(&f.ffmpegPath, "ffmpeg", "ffmpeg", "Path to ffmpeg binary")
+	fs.StringVar(&f.outDir, "out", "./downloads", "Output directory")
+	fs.IntVar(&f.timeout, "timeout", 60, "Max seconds to wait per attempt")
+	fs.BoolVar(&f.debug, "debug", false, "Enable debug logging")
+	fs.BoolVar(&f.progress, "dl-progress", false, "Show console progress bar")
+	fs.StringVar(&f.name, "name", "", "Output file name template, e.g. \"{title} [{id}].{ext}\" or \"{date}/{channel}/{title}.{ext}\" (default \"{id}.{ext}\")")
+	fs.BoolVar(&f.tags, "tags", false, "Embed title, channel, source URL and upload date into output files")
+
+	fs.IntVar(&f.maxFileMB, "max-file-mb", 0, "Max size of a single downloaded file in MB (0 = unlimited)")
+	fs.IntVar(&f.quotaMB, "quota-mb", 0, "Total storage quota in MB, old files are evicted when exceeded (0 = unlimited)")
+	fs.IntVar(&f.maxJobs, "max-jobs", 0, "Max concurrent downloads/muxes, extra ones wait in a queue (0 = unlimited)")
+	fs.IntVar(&f.bandwidthKBps, "bandwidth-kbps", 0, "Total download speed cap in KB/s (0 = unlimited)")
+	fs.StringVar(&f.maxDuration, "max-duration", "", "Reject longer videos before downloading (90m, 2h, 1:30:00)")
+	fs.IntVar(&f.maxSizeMB, "max-size-mb", 0, "Reject videos estimated to be larger than this before downloading (0 = unlimited)")
+	fs.BoolVar(&f.rejectLive, "reject-live", false, "Reject streams that are live right now")
+	fs.StringVar(&f.providers, "providers", "", "Comma-separated providers to use, see the providers command (default all)")
+
+	fs.StringVar(&f.s3Endpoint, "s3-endpoint", "", "S3-compatible endpoint URL for shared storage (credentials from AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY)")
+	fs.StringVar(&f.s3Bucket, "s3-bucket", "", "S3 bucket name")
+	fs.StringVar(&f.s3Region, "s3-region", "us-east-1", "S3 region")
+	fs.StringVar(&f.s3Prefix, "s3-prefix", "", "Key prefix inside the S3 bucket")
+	return f
+}
+
+// newGateway initializes the gateway from the flags, exiting on failure.
+func (f *gatewayFlags) newGateway() *gateway.Service {
+	var maxDurationSec float64
+	if f.maxDuration != "" {
+		var err error
+		if maxDurationSec, err = utils.ParseTimestamp(f.maxDuration); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -max-duration value: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var store storage.Storage
+	if f.s3Endpoint != "" {
+		s3, err := storage.NewS3(f.s3Endpoint, f.s3Region, f.s3Bucket, os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Storage setup failed: %v\n", err)
+			os.Exit(1)
+		}
+		s3.Prefix = f.s3Prefix
+		store = s3
+	}
+
+	gw, err := gateway.New(gateway.Config{
+		OutputDir:        f.outDir,
+		FFmpegPath:       f.ffmpegPath,
+		TimeoutSec:       f.timeout,
+		Debug:            f.debug,
+		LogOutput:        f.logOutput,
+		ShowProgress:     f.progress,
+		Storage:          store,
+		MaxFileMB:        f.maxFileMB,
+		QuotaMB:          f.quotaMB,
+		MaxJobs:          f.maxJobs,
+		BandwidthKBps:    f.bandwidthKBps,
+		EmbedMetadata:    f.tags,
+		FileNameTemplate: f.name,
+		MaxDurationSec:   int(maxDurationSec),
+		MaxEstimatedMB:   f.maxSizeMB,
+		RejectLive:       f.rejectLive,
+		Providers:        splitList(f.providers),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Initialization failed: %v\n", err)
+		os.Exit(1)
+	}
+	return gw
+}
+
+// getFlags select what get downloads and how the result is processed.
+type getFlags struct {
+	url        string
+	playlist   string
+	batch      string
+	workers    int
+	start      string
+	end        string
+	accurate   bool
+	thumb      string
+	sheet      bool
+	anim       string
+	animWidth  int
+	animFPS    float64
+	subs       string
+	subsFormat string
+	subsAuto   bool
+	subsEmbed  bool
+	subsBurn   bool
+	split      string
+	json       bool
+}
+
+func addGetFlags(fs *flag.FlagSet) *getFlags {
+	f := &getFlags{}
+	fs.StringVar(&f.url, "url", "", "YouTube URL or ID (URLs can also follow the flags)")
+	fs.StringVar(&f.playlist, "playlist", "", "Process every video of a playlist (URL with list= or playlist ID)")
+	fs.StringVar(&f.batch, "batch", "", "Read URLs from a file, one per line (\"-\" = stdin, # starts a comment)")
+	fs.IntVar(&f.workers, "workers", gateway.DefaultBatchWorkers, "Videos processed at once for -playlist, -batch and several URLs")
+
+	fs.StringVar(&f.start, "start", "", "Clip start (90, 1:30, 1m30s); defaults to t=/start= in the URL")
+	fs.StringVar(&f.end, "end", "", "Clip end; defaults to end= in the URL")
+	fs.BoolVar(&f.accurate, "accurate", false, "Re-encode the clip so it starts exactly at -start instead of the previous keyframe")
+	fs.StringVar(&f.thumb, "thumb", "", "Save a thumbnail: \"cdn\" for YouTube's image or a timestamp to grab a frame (needs a full ffmpeg build, else YouTube's image is saved)")
+	fs.BoolVar(&f.sheet, "contact-sheet", false, "Also save a 4x4 contact sheet of frames (needs a full ffmpeg build)")
+	fs.StringVar(&f.anim, "anim", "", "Export an animated \"gif\" or \"webp\" of -start/-end (10s by default) instead of the video (needs a full ffmpeg build)")
+	fs.IntVar(&f.animWidth, "anim-width", 480, "Animation width in pixels")
+	fs.Float64Var(&f.animFPS, "anim-fps", 12, "Animation frame rate")
+	fs.StringVar(&f.subs, "subs", "", "Save subtitles in these languages, e.g. \"en,de\" (\"any\" = first available)")
+	fs.StringVar(&f.subsFormat, "subs-format", "srt", "Subtitle file format: srt or vtt")
+	fs.BoolVar(&f.subsAuto, "subs-auto", false, "Allow automatically generated subtitles when there are no manual ones")
+	fs.BoolVar(&f.subsEmbed, "subs-embed", false, "Embed the subtitles into the video as soft subtitles (needs a full ffmpeg build)")
+	fs.BoolVar(&f.subsBurn, "subs-burn", false, "Burn the first subtitle language into the picture (needs a full ffmpeg build)")
+	fs.StringVar(&f.split, "split", "", "Split the result: size (50MB), duration (10m), at:<t1>,<t2>... or chapters")
+	fs.BoolVar(&f.json, "json", false, "Print one JSON document per URL to stdout (JSON lines for several URLs), logs go to stderr")
+	return f
+}
+
+// options converts the flags into processing options. -start/-end apply to every video,
+// otherwise each one is cut to the range of its own URL. split is nil unless -split was given.
+func (f *getFlags) options() (opts gateway.Options, split *ffmpeg.SplitOptions, err error) {
+	if f.split != "" {
+		s, serr := gateway.ParseSplitSpec(f.split)
+		if serr != nil {
+			return opts, nil, fmt.Errorf("invalid -split value: %w", serr)
+		}
+		split = &s
+	}
+
+	opts.ClipFromURL = true
+	opts.Clip.Accurate = f.accurate
+	if f.start != "" {
+		if opts.Clip.Start, err = utils.ParseTimestamp(f.start); err != nil {
+			return opts, nil, fmt.Errorf("invalid -start value: %w", err)
+		}
+	}
+	if f.end != "" {
+		if opts.Clip.End, err = utils.ParseTimestamp(f.end); err != nil {
+			return opts, nil, fmt.Errorf("invalid -end value: %w", err)
+		}
+	}
+
+	if f.thumb != "" || f.sheet {
+		opts.Thumbnail = &gateway.ThumbnailOptions{ContactSheet: f.sheet}
+		if f.thumb != "" && f.thumb != "cdn" {
+			opts.Thumbnail.FromVideo = true
+			if opts.Thumbnail.At, err = utils.ParseTimestamp(f.thumb); err != nil {
+				return opts, nil, fmt.Errorf("invalid -thumb value: %w", err)
+			}
+		}
+	}
+
+	if f.subs != "" {
+		opts.Subtitles = &gateway.SubtitleOptions{
+			Languages: gateway.ParseSubtitleLanguages(f.subs),
+			Format:    f.subsFormat,
+			Auto:      f.subsAuto,
+			Embed:     f.subsEmbed,
+			Burn:      f.subsBurn,
+		}
+		if err := opts.Subtitles.Validate(); err != nil {
+			return opts, nil, fmt.Errorf("invalid subtitle options: %w", err)
+		}
+	}
+
+	if f.anim != "" {
+		opts.Animation = &ffmpeg.AnimationOptions{Format: f.anim, Width: f.animWidth, FPS: f.animFPS}
+		check := *opts.Animation
+		if err := check.Normalize(); err != nil {
+			return opts, nil, fmt.Errorf("invalid -anim value: %w", err)
+		}
+	}
+	return opts, split, nil
+}
+
+// serveFlags configure the API server.
+type serveFlags struct {
+	port             int
+	host             string
+	fileTTL          time.Duration
+	shutdownTimeout  time.Duration
+	apiKeys          string
+	keyPerMinute     int
+	keyPerDay        int
+	adminKey         string
+	filesNeedKey     bool
+	urlSecrets       string
+	urlTTL           time.Duration
+	web              bool
+	maxJobsPerClient int
+	clientQueue      int
+	ipPerMinute      int
+	ipBurst          int
+	trustedProxies   string
+	maxBody          int64
+}
+
+func addServeFlags(fs *flag.FlagSet) *serveFlags {
+	f := &serveFlags{}
+	fs.IntVar(&f.port, "port", 8080, "Port for API server")
+	fs.StringVar(&f.host, "host", "", "Public base URL for file links, e.g. https://dl.example.com (default http://localhost:<port>)")
+	fs.DurationVar(&f.fileTTL, "file-ttl", 10*time.Minute, "Delete served files after this long")
+	fs.DurationVar(&f.shutdownTimeout, "shutdown-timeout", 30*time.Second, "On SIGTERM, wait this long for running downloads before cancelling them")
+	fs.StringVar(&f.apiKeys, "api-keys", "", "Require API keys: comma-separated \"secret\" or \"name:secret[:per_minute[:per_day]]\" (default open API)")
+	fs.IntVar(&f.keyPerMinute, "key-per-minute", 0, "New downloads per minute for keys without their own limit (0 = unlimited)")
+	fs.IntVar(&f.keyPerDay, "key-per-day", 0, "Videos per UTC day for keys without their own limit (0 = unlimited)")
+	fs.StringVar(&f.adminKey, "admin-key", "", "Key for GET /api/admin/usage (default endpoint disabled)")
+	fs.BoolVar(&f.filesNeedKey, "files-need-key", false, "Require an API key for /files/ downloads too")
+	fs.StringVar(&f.urlSecrets, "url-secrets", "", "Sign /files/ links with these comma-separated secrets: the first signs, all verify (default plain links)")
+	fs.DurationVar(&f.urlTTL, "url-ttl", time.Hour, "How long signed /files/ links stay valid")
+	fs.BoolVar(&f.web, "onweb", false, "Enable simple Web UI")
+	fs.IntVar(&f.maxJobsPerClient, "max-jobs-per-client", 0, "Max concurrent API downloads per client IP (0 = unlimited)")
+	fs.IntVar(&f.clientQueue, "client-queue", 0, "API downloads a client IP can have waiting for a slot with -max-jobs-per-client, more are rejected with 429 (0 = unlimited)")
+	fs.IntVar(&f.ipPerMinute, "ip-per-minute", 0, "New API downloads and playlists per minute per client IP (0 = unlimited)")
+	fs.IntVar(&f.ipBurst, "ip-burst", 0, "How many of -ip-per-minute a client IP can start at once (default -ip-per-minute)")
+	fs.StringVar(&f.trustedProxies, "trusted-proxies", "", "Comma-separated IPs or CIDR ranges of reverse proxies whose X-Forwarded-For is trusted")
+	fs.Int64Var(&f.maxBody, "max-body", 64<<10, "Max size of API request bodies in bytes")
+	return f
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,74 +1,249 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
-	"time"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/imbecility/yt-gateway/pkg/api"
 	"github.com/imbecility/yt-gateway/pkg/gateway"
 )
 
+// exitRejected is the exit code for videos rejected by -max-duration, -max-size-mb or -reject-live.
+const exitRejected = 3
+
+// command is a subcommand of the CLI.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	// assigned in init: the commands print the usage, which lists the commands
+	commands = []command{
+		{"get", "[flags] <URL>...", "Download videos, playlists (-playlist) or link lists (-batch)", cmdGet},
+		{"serve", "[flags]", "Run the HTTP API (and the Web UI with -onweb)", cmdServe},
+		{"info", "[flags] <URL>", "Show the video metadata without downloading", cmdInfo},
+		{"formats", "[flags] <URL>", "List the streams the providers offer for a video", cmdFormats},
+		{"providers", "[flags]", "List the providers and test each with a video", cmdProviders},
+		{"doctor", "[flags]", "Check ffmpeg, the output directory and the providers' reachability", cmdDoctor},
+		{"config", "print [flags]", "Show the effective settings (flags > YTGW_* env > config file > defaults)", cmdConfig},
+	}
+}
+
 func main() {
-	urlFlag := flag.String("url", "", "YouTube URL or ID")
-	ffmpegPath := flag.String("ffmpeg", "ffmpeg", "Path to ffmpeg binary")
-	outDir := flag.String("out", "./downloads", "Output directory")
-	timeoutFlag := flag.Int("timeout", 60, "Max seconds to wait per attempt")
-	debugFlag := flag.Bool("debug", false, "Enable debug logging")
-
-	apiMode := flag.Bool("api", false, "Run in API Server mode")
-	apiPort := flag.Int("port", 8080, "Port for API server")
-	webMode := flag.Bool("onweb", false, "Enable simple Web UI")
-	dlProgress := flag.Bool("dl-progress", false, "Show console progress bar")
-
-	flag.Parse()
-
-	gw, err := gateway.New(gateway.Config{
-		OutputDir:    *outDir,
-		FFmpegPath:   *ffmpegPath,
-		TimeoutSec:   *timeoutFlag,
-		Debug:        *debugFlag,
-		ShowProgress: *dlProgress,
-	})
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(legacy(os.Args[1:]))
+	}
 
-	if err != nil {
-		fmt.Printf("Initialization failed: %v\n", err)
-		os.Exit(1)
+	name := os.Args[1]
+	for _, c := range commands {
+		if c.name == name {
+			os.Exit(c.run(os.Args[2:]))
+		}
 	}
+	if name == "help" {
+		usage()
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
 
-	// API Server
-	if *apiMode {
-		srv := &api.Server{
-			Port:       *apiPort,
-			Gateway:    gw,
-			Downloader: gw.Downloader,
-			Host:       fmt.Sprintf("http://localhost:%d", *apiPort),
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: yt-gateway <command> [flags] [args]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun \"yt-gateway <command> -h\" for the flags of a command.\n")
+}
+
+// newFlagSet creates the flag set of a command with help text in the common format.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		for _, c := range commands {
+			if c.name == name {
+				fmt.Fprintf(os.Stderr, "Usage: yt-gateway %s %s\n\n%s.\n\nFlags:\n", c.name, c.args, c.summary)
+			}
 		}
+		fs.PrintDefaults()
+	}
+	addConfigFlag(fs)
+	return fs
+}
+
+// legacy runs the flat flags of earlier versions: -api serves, anything else gets.
+func legacy(args []string) int {
+	fs := flag.NewFlagSet("yt-gateway", flag.ExitOnError)
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintf(os.Stderr, "\nWithout a command, the flags of get and serve are accepted (-api selects serve):\n")
+		fs.PrintDefaults()
+	}
+	gf := addGatewayFlags(fs)
+	get := addGetFlags(fs)
+	serve := addServeFlags(fs)
+	apiMode := fs.Bool("api", false, "Run in API Server mode (same as the serve command)")
+	addConfigFlag(fs)
+	parseFlags(fs, args)
+
+	if *apiMode {
+		return runServe(gf, serve)
+	}
+	if get.url == "" && get.playlist == "" && get.batch == "" && fs.NArg() == 0 {
+		fs.Usage()
+		return 1
+	}
+	return runGet(gf, get, fs.Args())
+}
+
+func cmdGet(args []string) int {
+	fs := newFlagSet("get")
+	gf := addGatewayFlags(fs)
+	get := addGetFlags(fs)
+	parseFlags(fs, args)
+	return runGet(gf, get, fs.Args())
+}
 
-		go srv.BackgroundCleaner(10 * time.Minute)
+func cmdServe(args []string) int {
+	fs := newFlagSet("serve")
+	gf := addGatewayFlags(fs)
+	serve := addServeFlags(fs)
+	parseFlags(fs, args)
+	return runServe(gf, serve)
+}
 
-		if sterr := srv.Start(*webMode); sterr != nil {
-			slog.Error("Server crashed", "err", sterr)
-			os.Exit(1)
+func runServe(gf *gatewayFlags, f *serveFlags) int {
+	var keys []api.APIKey
+	for _, spec := range splitList(f.apiKeys) {
+		key, err := api.ParseAPIKey(spec)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
 		}
-		return
+		keys = append(keys, key)
+	}
+	proxies, err := api.ParseTrustedProxies(splitList(f.trustedProxies))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	gw := gf.newGateway()
+	host := strings.TrimSuffix(f.host, "/")
+	if host == "" {
+		host = fmt.Sprintf("http://localhost:%d", f.port)
+	}
+	srv := &api.Server{
+		Port:               f.port,
+		Gateway:            gw,
+		Downloader:         gw.Downloader,
+		Host:               host,
+		MaxJobsPerClient:   f.maxJobsPerClient,
+		MaxQueuedPerClient: f.clientQueue,
+		IPPerMinute:        f.ipPerMinute,
+		IPBurst:            f.ipBurst,
+		TrustedProxies:     proxies,
+		MaxBodyBytes:       f.maxBody,
+		ShutdownTimeout:    f.shutdownTimeout,
+		APIKeys:            keys,
+		KeyPerMinute:       f.keyPerMinute,
+		KeyPerDay:          f.keyPerDay,
+		AdminKey:           f.adminKey,
+		FilesNeedKey:       f.filesNeedKey,
+		URLSecrets:         splitList(f.urlSecrets),
+		URLTTL:             f.urlTTL,
 	}
 
-	// CLI
-	if *urlFlag == "" {
-		slog.Error("Usage: -url <LINK> or -api")
-		os.Exit(1)
+	// SIGTERM (container stop) or Ctrl+C lets running downloads finish, up to -shutdown-timeout
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go srv.BackgroundCleaner(ctx, f.fileTTL)
+
+	if sterr := srv.Run(ctx, f.web); sterr != nil {
+		slog.Error("Server crashed", "err", sterr)
+		return 1
 	}
+	return 0
+}
 
-	slog.Info("Processing video via CLI", "url", *urlFlag)
+func runGet(gf *gatewayFlags, f *getFlags, args []string) int {
+	urls := args
+	if f.url != "" {
+		urls = append([]string{f.url}, urls...)
+	}
+	if f.batch != "" {
+		listed, berr := readBatch(f.batch)
+		if berr != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read batch: %v\n", berr)
+			return 1
+		}
+		urls = append(urls, listed...)
+	}
+	if len(urls) == 0 && f.playlist == "" {
+		fmt.Fprintln(os.Stderr, "Usage: yt-gateway get [flags] <URL>..., -batch <FILE> or -playlist <URL>")
+		return 1
+	}
 
-	res, path, err := gw.ProcessVideo(*urlFlag)
+	opts, split, err := f.options()
 	if err != nil {
-		slog.Error("Failed to process video", "err", err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if f.json {
+		gf.logOutput = os.Stderr
+	}
+	gw := gf.newGateway()
+	// fail before downloading anything
+	if opts.Animation != nil {
+		if err := gw.Downloader.Muxer().SupportsAnimation(opts.Animation.Format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if subs := opts.Subtitles; subs != nil && (subs.Embed || subs.Burn) {
+		if err := gw.Downloader.Muxer().SupportsSubtitles(subs.Burn); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
 	}
+	out := &output{gw: gw, split: split, json: f.json}
 
-	slog.Info("Success", "title", res.Title, "path", path)
+	if f.playlist != "" {
+		out.batch = true
+		return runPlaylist(gw, f.playlist, opts, f.workers, out)
+	}
+	if len(urls) > 1 || f.batch != "" {
+		out.batch = true
+		return runURLs(gw, urls, opts, f.workers, out)
+	}
+
+	first := urls[0]
+	slog.Info("Processing video via CLI", "url", first)
+
+	item := gateway.BatchItem{URL: first}
+	item.Result, item.Path, item.Err = gw.ProcessVideoWith(first, opts)
+	if err := out.result(item); err != nil {
+		slog.Error("Failed to process video", "err", err)
+		var lerr *gateway.LimitError
+		if errors.As(err, &lerr) {
+			return exitRejected
+		}
+		return 1
+	}
+	return 0
 }
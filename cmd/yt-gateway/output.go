@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/imbecility/yt-gateway/pkg/ffmpeg"
+	"github.com/imbecility/yt-gateway/pkg/gateway"
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/utils"
+)
+
+// output reports what get produced: log lines, or with -json one JSON document
+// per URL on stdout (JSON lines for batches) while the logs go to stderr.
+type output struct {
+	gw    *gateway.Service
+	split *ffmpeg.SplitOptions
+	json  bool
+	// batch numbers the JSON documents by position, they are printed as videos finish.
+	batch bool
+}
+
+// jsonResult is the -json document of a URL: the API response plus what only the CLI knows.
+type jsonResult struct {
+	// Index is the position of the URL in a batch, from 1.
+	Index int    `json:"index,omitempty"`
+	URL   string `json:"url"`
+	models.APIResponse
+	Provider string `json:"provider,omitempty"`
+	// SizeBytes and DurationSec describe the saved file.
+	SizeBytes        int64          `json:"size_bytes,omitempty"`
+	DurationSec      float64        `json:"duration_sec,omitempty"`
+	ThumbnailPath    string         `json:"thumbnail_path,omitempty"`
+	ContactSheetPath string         `json:"contact_sheet_path,omitempty"`
+	Subtitles        []jsonSubtitle `json:"subtitles,omitempty"`
+	Parts            []jsonPart     `json:"parts,omitempty"`
+}
+
+type jsonSubtitle struct {
+	Language string `json:"language"`
+	Auto     bool   `json:"auto,omitempty"`
+	Path     string `json:"path"`
+}
+
+type jsonPart struct {
+	Path      string  `json:"path"`
+	Title     string  `json:"title,omitempty"`
+	StartSec  float64 `json:"start_sec"`
+	EndSec    float64 `json:"end_sec"`
+	SizeBytes int64   `json:"size_bytes"`
+}
+
+// result splits a processed item if -split was given and reports it.
+// It returns the error of the item or of the split.
+func (o *output) result(item gateway.BatchItem) error {
+	var parts []ffmpeg.Part
+	err := item.Err
+	if err == nil && o.split != nil {
+		parts, err = o.gw.Split(item.Path, item.Result, *o.split)
+	}
+
+	if o.json {
+		o.print(o.document(item, parts, err))
+	} else if err == nil {
+		logResult(item.Result, item.Path, parts)
+	}
+	return err
+}
+
+// fail reports an error that happened before any video was processed.
+func (o *output) fail(rawURL string, err error) {
+	if o.json {
+		o.print(o.document(gateway.BatchItem{URL: rawURL}, nil, err))
+	}
+}
+
+func (o *output) print(doc jsonResult) {
+	if err := json.NewEncoder(os.Stdout).Encode(doc); err != nil {
+		slog.Error("JSON encoding failed", "error", err)
+	}
+}
+
+func (o *output) document(item gateway.BatchItem, parts []ffmpeg.Part, err error) jsonResult {
+	doc := jsonResult{URL: item.URL}
+	if o.batch {
+		doc.Index = item.Index + 1
+	}
+	res := item.Result
+
+	if err != nil {
+		doc.APIResponse = models.APIResponse{Success: false, Error: err.Error()}
+		var lerr *gateway.LimitError
+		if errors.As(err, &lerr) {
+			doc.Code = lerr.Code
+		}
+		if res != nil {
+			// the video was saved, splitting failed
+			doc.Title, doc.VideoID, doc.LocalPath = res.Title, res.VideoID, item.Path
+		} else {
+			doc.VideoID = utils.ExtractVideoID(item.URL)
+		}
+		return doc
+	}
+
+	doc.APIResponse = models.APIResponse{
+		Success:   true,
+		Title:     res.Title,
+		VideoID:   res.VideoID,
+		LocalPath: item.Path,
+		Metadata:  res.Metadata,
+		Media:     res.Media,
+	}
+	doc.Provider = res.Provider
+	if res.Media != nil {
+		doc.SizeBytes, doc.DurationSec = res.Media.SizeBytes, res.Media.DurationSec
+	}
+	if doc.SizeBytes == 0 {
+		if fi, serr := os.Stat(item.Path); serr == nil {
+			doc.SizeBytes = fi.Size()
+		}
+	}
+	if doc.DurationSec == 0 && res.Metadata != nil {
+		doc.DurationSec = res.Metadata.DurationSec
+	}
+
+	doc.ThumbnailPath = absPath(res.ThumbnailPath)
+	doc.ContactSheetPath = absPath(res.ContactSheetPath)
+	for _, sub := range res.Subtitles {
+		doc.Subtitles = append(doc.Subtitles, jsonSubtitle{Language: sub.Language, Auto: sub.Auto, Path: absPath(sub.Path)})
+	}
+	for _, p := range parts {
+		doc.Parts = append(doc.Parts, jsonPart{Path: absPath(p.Path), Title: p.Title, StartSec: p.Start, EndSec: p.End, SizeBytes: p.Size})
+	}
+	return doc
+}
+
+// logResult logs what was produced for a video.
+func logResult(res *models.VideoResult, path string, parts []ffmpeg.Part) {
+	for _, p := range parts {
+		slog.Info("Part", "path", p.Path, "start", utils.FormatTimestamp(p.Start), "end", utils.FormatTimestamp(p.End), "size_mb", p.Size/1024/1024)
+	}
+
+	if md := res.Metadata; md != nil {
+		slog.Info("Video", "channel", md.Channel, "uploaded", md.UploadDate, "duration", utils.FormatTimestamp(md.DurationSec),
+			"views", md.ViewCount, "live", md.IsLive, "short", md.IsShort, "age_restricted", md.AgeRestricted, "chapters", len(md.Chapters))
+	}
+
+	if res.ThumbnailPath != "" {
+		slog.Info("Thumbnail saved", "path", res.ThumbnailPath, "contact_sheet", res.ContactSheetPath)
+	}
+
+	for _, sub := range res.Subtitles {
+		slog.Info("Subtitles saved", "language", sub.Language, "auto", sub.Auto, "path", sub.Path)
+	}
+
+	slog.Info("Success", "title", res.Title, "provider", res.Provider, "path", path)
+}
+
+// absPath makes path absolute, keeping "" for files that weren't produced.
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
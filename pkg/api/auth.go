@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/throttle"
+)
+
+// Error codes of rejected API requests.
+const (
+	CodeUnauthorized  = "unauthorized"
+	CodeRateLimited   = "rate_limited"
+	CodeQuotaExceeded = "quota_exceeded"
+)
+
+// APIKey lets a client use the API. Zero limits fall back to the server's defaults.
+type APIKey struct {
+	// Name identifies the key in logs and usage reports.
+	Name   string
+	Secret string
+	// PerMinute caps new downloads (requests to /api/download and /api/playlist) per minute.
+	PerMinute int
+	// PerDay caps the videos downloaded per UTC day.
+	PerDay int
+}
+
+// ParseAPIKey reads a key spec: "secret" or "name:secret[:per_minute[:per_day]]".
+func ParseAPIKey(spec string) (APIKey, error) {
+	parts := strings.Split(strings.TrimSpace(spec), ":")
+	if len(parts) == 1 {
+		parts = []string{"", parts[0]}
+	}
+	if len(parts) > 4 || parts[1] == "" {
+		return APIKey{}, fmt.Errorf("invalid API key %q, want secret or name:secret[:per_minute[:per_day]]", spec)
+	}
+
+	key := APIKey{Name: parts[0], Secret: parts[1]}
+	if key.Name == "" {
+		// never log the secret, only enough to tell keys apart
+		key.Name = "key-" + fmt.Sprintf("%x", sha256.Sum256([]byte(key.Secret)))[:8]
+	}
+	limits := []*int{&key.PerMinute, &key.PerDay}
+	for i, p := range parts[2:] {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return APIKey{}, fmt.Errorf("invalid limit %q of API key %s", p, key.Name)
+		}
+		*limits[i] = n
+	}
+	return key, nil
+}
+
+// usageStats are the counters of a key, as reported by the admin endpoint.
+type usageStats struct {
+	Name      string `json:"name"`
+	PerMinute int    `json:"per_minute,omitempty"`
+	PerDay    int    `json:"per_day,omitempty"`
+	Requests  int64  `json:"requests"`
+	// Day is the UTC date DownloadsToday counts for.
+	Day            string    `json:"day"`
+	DownloadsToday int       `json:"downloads_today"`
+	DownloadsTotal int64     `json:"downloads_total"`
+	RateLimited    int64     `json:"rate_limited"`
+	QuotaExceeded  int64     `json:"quota_exceeded"`
+	LastUsed       time.Time `json:"last_used,omitzero"`
+}
+
+// keyUsage tracks what a key did, since the server started.
+type keyUsage struct {
+	mu    sync.Mutex
+	stats usageStats
+	rate  *throttle.Bucket
+}
+
+// rollDay starts a new daily count when the UTC date changed. Call with mu held.
+func (u *keyUsage) rollDay() {
+	if today := time.Now().UTC().Format(time.DateOnly); u.stats.Day != today {
+		u.stats.Day, u.stats.DownloadsToday = today, 0
+	}
+}
+
+// take counts n downloads against the daily quota, unless that would exceed it.
+func (u *keyUsage) take(n int) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.rollDay()
+	if u.stats.PerDay > 0 && u.stats.DownloadsToday+n > u.stats.PerDay {
+		u.stats.QuotaExceeded++
+		return false
+	}
+	u.stats.DownloadsToday += n
+	u.stats.DownloadsTotal += int64(n)
+	return true
+}
+
+// refund gives back n downloads that failed.
+func (u *keyUsage) refund(n int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.stats.DownloadsToday = max(u.stats.DownloadsToday-n, 0)
+	u.stats.DownloadsTotal -= int64(n)
+}
+
+func (u *keyUsage) snapshot() usageStats {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.rollDay()
+	return u.stats
+}
+
+// keyRing holds the usage of every configured key, looked up by the hash of the secret.
+type keyRing struct {
+	bySecret map[[32]byte]*keyUsage
+}
+
+func newKeyRing(keys []APIKey, perMinute, perDay int) *keyRing {
+	ring := &keyRing{bySecret: make(map[[32]byte]*keyUsage)}
+	for _, k := range keys {
+		u := &keyUsage{stats: usageStats{Name: k.Name, PerMinute: k.PerMinute, PerDay: k.PerDay}}
+		if u.stats.PerMinute == 0 {
+			u.stats.PerMinute = perMinute
+		}
+		if u.stats.PerDay == 0 {
+			u.stats.PerDay = perDay
+		}
+		u.rate = throttle.NewBucket(float64(u.stats.PerMinute)/60, float64(u.stats.PerMinute))
+		ring.bySecret[sha256.Sum256([]byte(k.Secret))] = u
+	}
+	return ring
+}
+
+func (k *keyRing) lookup(secret string) *keyUsage {
+	if secret == "" {
+		return nil
+	}
+	return k.bySecret[sha256.Sum256([]byte(secret))]
+}
+
+// requestKey returns the key sent in the X-API-Key header, as a bearer token or in the api_key parameter.
+func requestKey(r *http.Request) string {
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+type keyCtx struct{}
+
+// requireKey lets only requests with a valid key through to next, when keys are configured.
+// With limited the request also counts against the key's rate limit.
+func (s *Server) requireKey(next http.HandlerFunc, limited bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(s.keys.bySecret) == 0 {
+			next(w, r)
+			return
+		}
+		u := s.keys.lookup(requestKey(r))
+		if u == nil {
+			s.reject(w, http.StatusUnauthorized, 0, models.APIResponse{Error: "Missing or invalid API key", Code: CodeUnauthorized})
+			return
+		}
+
+		u.mu.Lock()
+		u.stats.Requests++
+		u.stats.LastUsed = time.Now()
+		u.mu.Unlock()
+		if limited {
+			if ok, wait := u.rate.Allow(); !ok {
+				u.mu.Lock()
+				u.stats.RateLimited++
+				u.mu.Unlock()
+				s.reject(w, http.StatusTooManyRequests, wait, models.APIResponse{Error: "Rate limit exceeded", Code: CodeRateLimited})
+				return
+			}
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), keyCtx{}, u)))
+	}
+}
+
+// takeQuota counts n downloads against the daily quota of the request's key. If the quota
+// is used up it responds with 429 and returns false. refund gives back downloads that failed.
+func (s *Server) takeQuota(w http.ResponseWriter, r *http.Request, n int) (refund func(n int), ok bool) {
+	u, _ := r.Context().Value(keyCtx{}).(*keyUsage)
+	if u == nil {
+		return func(int) {}, true
+	}
+	if !u.take(n) {
+		now := time.Now().UTC()
+		midnight := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		s.reject(w, http.StatusTooManyRequests, midnight.Sub(now), models.APIResponse{Error: "Daily download quota exceeded", Code: CodeQuotaExceeded})
+		return nil, false
+	}
+	return u.refund, true
+}
+
+// reject responds with an error status; retryAfter > 0 is sent as Retry-After in whole seconds.
+func (s *Server) reject(w http.ResponseWriter, status int, retryAfter time.Duration, resp models.APIResponse) {
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	s.respondJSON(w, resp)
+}
+
+// handleUsage reports the usage of every key: GET /api/admin/usage with the admin key.
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := requestKey(r)
+	if key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(s.AdminKey)) != 1 {
+		s.reject(w, http.StatusUnauthorized, 0, models.APIResponse{Error: "Missing or invalid admin key", Code: CodeUnauthorized})
+		return
+	}
+
+	usage := make([]usageStats, 0, len(s.keys.bySecret))
+	for _, u := range s.keys.bySecret {
+		usage = append(usage, u.snapshot())
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Name < usage[j].Name })
+	s.respondJSON(w, struct {
+		Keys []usageStats `json:"keys"`
+	}{usage})
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imbecility/yt-gateway/pkg/gateway"
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/storage"
+	"github.com/imbecility/yt-gateway/pkg/utils"
+)
+
+// maxJobWorkers caps the parallelism an API client can ask for.
+const maxJobWorkers = 5
+
+// jobTTL is how long a finished job can still be polled.
+const jobTTL = time.Hour
+
+// batchJob is a playlist processed in the background; clients poll it by ID.
+type batchJob struct {
+	mu       sync.Mutex
+	ID       string `json:"job_id"`
+	Title    string `json:"title,omitempty"`
+	Total    int    `json:"total"`
+	Done     int    `json:"done"`
+	Failed   int    `json:"failed"`
+	Finished bool   `json:"finished"`
+	// Truncated means the playlist has more videos than the job, see providers.Playlist.
+	Truncated bool      `json:"truncated,omitempty"`
+	Items     []jobItem `json:"items"`
+	ended     time.Time
+	// owner is the key that started the job, nil without keys; only it can poll the job.
+	owner *keyUsage
+}
+
+// jobItem is one video of a job, in playlist order.
+type jobItem struct {
+	// Status is "pending", "done" or "failed".
+	Status string `json:"status"`
+	models.APIResponse
+}
+
+// handlePlaylist starts a batch job for a playlist: POST {"url": "...", "workers": 3}.
+func (s *Server) handlePlaylist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		URL     string `json:"url"`
+		Workers int    `json:"workers"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if req.Workers <= 0 {
+		req.Workers = gateway.DefaultBatchWorkers
+	}
+	req.Workers = min(req.Workers, maxJobWorkers)
+	if utils.ExtractPlaylistID(req.URL) == "" {
+		s.respondJSON(w, models.APIResponse{Success: false, Error: "Invalid playlist URL"})
+		return
+	}
+	client := s.clientIP(r)
+	// the whole job counts as one download of the client
+	slot, ok := s.reserveJob(w, client)
+	if !ok {
+		return
+	}
+
+	playlist, err := s.Gateway.ResolvePlaylist(req.URL)
+	if err != nil {
+		slot.Cancel()
+		slog.Error("Playlist failed", "url", req.URL, "err", err)
+		s.respondJSON(w, models.APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+
+	refund, ok := s.takeQuota(w, r, len(playlist.VideoIDs))
+	if !ok {
+		slot.Cancel()
+		return
+	}
+
+	job := &batchJob{ID: newJobID(), Title: playlist.Title, Total: len(playlist.VideoIDs), Truncated: playlist.Truncated}
+	job.owner, _ = r.Context().Value(keyCtx{}).(*keyUsage)
+	urls := make([]string, len(playlist.VideoIDs))
+	for i, id := range playlist.VideoIDs {
+		urls[i] = "https://www.youtube.com/watch?v=" + id
+		job.Items = append(job.Items, jobItem{Status: "pending", APIResponse: models.APIResponse{VideoID: id}})
+	}
+	s.jobsMu.Lock()
+	s.jobs[job.ID] = job
+	s.jobsMu.Unlock()
+
+	slog.Info("Playlist job started", "job", job.ID, "videos", job.Total, "workers", req.Workers, "client", client)
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		release, err := slot.Acquire(s.stopping)
+		if err != nil {
+			refund(job.Total)
+			return
+		}
+		defer release()
+
+		// on shutdown the videos not started yet are reported as failed
+		for item := range s.Gateway.ProcessBatch(s.stopping, urls, gateway.Options{}, req.Workers) {
+			entry := jobItem{Status: "done"}
+			if item.Err != nil {
+				refund(1)
+				entry = jobItem{Status: "failed", APIResponse: errorResponse(item.Err)}
+				entry.VideoID = playlist.VideoIDs[item.Index]
+			} else {
+				entry.APIResponse = s.resultResponse(item.Result, item.Path)
+			}
+
+			job.mu.Lock()
+			job.Items[item.Index] = entry
+			if item.Err != nil {
+				job.Failed++
+			}
+			job.Done++
+			job.mu.Unlock()
+		}
+
+		job.mu.Lock()
+		job.Finished, job.ended = true, time.Now()
+		job.mu.Unlock()
+		slog.Info("Playlist job finished", "job", job.ID, "videos", job.Total, "failed", job.Failed)
+	}()
+
+	s.respondJSON(w, struct {
+		Success   bool   `json:"success"`
+		JobID     string `json:"job_id"`
+		Title     string `json:"title,omitempty"`
+		Total     int    `json:"total"`
+		Truncated bool   `json:"truncated,omitempty"`
+	}{true, job.ID, job.Title, job.Total, job.Truncated})
+}
+
+// handleJob reports the progress of a batch job: GET /api/jobs/<id>.
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+
+	s.jobsMu.Lock()
+	job := s.jobs[id]
+	s.jobsMu.Unlock()
+	// other keys' jobs are reported missing, so their IDs can't be probed
+	owner, _ := r.Context().Value(keyCtx{}).(*keyUsage)
+	if job == nil || job.owner != owner {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	s.respondJSON(w, job)
+}
+
+// pruneJobs forgets jobs that finished more than jobTTL ago.
+func (s *Server) pruneJobs() {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	for id, job := range s.jobs {
+		job.mu.Lock()
+		expired := job.Finished && time.Since(job.ended) > jobTTL
+		job.mu.Unlock()
+		if expired {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// resultResponse describes a processed video (its file already in storage) to the client.
+func (s *Server) resultResponse(res *models.VideoResult, localPath string) models.APIResponse {
+	response := models.APIResponse{
+		Success:   true,
+		Title:     res.Title,
+		VideoID:   res.VideoID,
+		StreamURL: s.fileURL(localPath),
+		Media:     res.Media,
+		Metadata:  res.Metadata,
+	}
+	if res.ThumbnailPath != "" {
+		response.ThumbnailURL = s.fileURL(res.ThumbnailPath)
+	}
+	if storage.IsLocal(s.Downloader.Storage) {
+		response.LocalPath, _ = filepath.Abs(localPath)
+	} else {
+		removeLocalCopies(localPath, res.ThumbnailPath)
+	}
+	return response
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/throttle"
+)
+
+// Error codes of requests rejected to protect the server.
+const (
+	CodeTooManyJobs  = "too_many_jobs"
+	CodeBodyTooLarge = "body_too_large"
+)
+
+// defaultMaxBodyBytes caps API request bodies, by default. They are small JSON documents.
+const defaultMaxBodyBytes = 64 << 10
+
+// busyRetryAfter is the Retry-After sent to clients over their job limit: a guess, since
+// nobody knows when their downloads finish.
+const busyRetryAfter = 10 * time.Second
+
+// ParseTrustedProxies reads the addresses of reverse proxies: IPs or CIDR ranges.
+func ParseTrustedProxies(specs []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, spec := range specs {
+		if p, err := netip.ParsePrefix(spec); err == nil {
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, want an IP or CIDR range", spec)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+func (s *Server) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range s.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP identifies the client for per-client limits. Behind trusted proxies it is the
+// last address in X-Forwarded-For that wasn't added by one of them.
+func (s *Server) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !s.trusted(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !s.trusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// limitIP lets each client IP start IPPerMinute requests per minute, the rest get 429.
+func (s *Server) limitIP(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := s.clientIP(r)
+		if ok, wait := s.ipRates.Allow(client); !ok {
+			slog.Info("Client rate limited", "client", client)
+			s.reject(w, http.StatusTooManyRequests, wait, models.APIResponse{Error: "Too many requests from your address", Code: CodeRateLimited})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// reserveJob queues the request for a job slot of the client. It rejects the request with 429
+// and returns false if the client already runs MaxJobsPerClient jobs and has MaxQueuedPerClient
+// more waiting. The reservation must be used or cancelled.
+func (s *Server) reserveJob(w http.ResponseWriter, client string) (*throttle.Reservation, bool) {
+	slot, ok := s.clientJobs.Reserve(client, s.MaxQueuedPerClient)
+	if !ok {
+		slog.Info("Client job limit reached, request rejected", "client", client)
+		s.reject(w, http.StatusTooManyRequests, busyRetryAfter, models.APIResponse{Error: "Too many downloads running for your address", Code: CodeTooManyJobs})
+	}
+	return slot, ok
+}
+
+// decodeBody reads the JSON request body into v, up to MaxBodyBytes. On failure it responds
+// with 400, or 413 if the body is too large, and returns false.
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	limit := s.MaxBodyBytes
+	if limit <= 0 {
+		limit = defaultMaxBodyBytes
+	}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		s.reject(w, http.StatusRequestEntityTooLarge, 0, models.APIResponse{Error: fmt.Sprintf("Request body over %d bytes", limit), Code: CodeBodyTooLarge})
+		return false
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
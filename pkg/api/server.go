@@ -1,36 +1,135 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/imbecility/yt-gateway/pkg/downloader"
+	"github.com/imbecility/yt-gateway/pkg/ffmpeg"
 	"github.com/imbecility/yt-gateway/pkg/gateway"
 	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/storage"
+	"github.com/imbecility/yt-gateway/pkg/throttle"
 	"github.com/imbecility/yt-gateway/pkg/utils"
 )
 
+// signedURLTTL is how long a storage redirect URL stays valid.
+const signedURLTTL = 15 * time.Minute
+
+// defaultShutdownTimeout is how long Run waits for running work when stopping, by default.
+const defaultShutdownTimeout = 30 * time.Second
+
 type Server struct {
-	Port            int
-	Gateway         *gateway.Service
-	Downloader      *downloader.Downloader
-	Host            string
+	Port       int
+	Gateway    *gateway.Service
+	Downloader *downloader.Downloader
+	Host       string
+	// MaxJobsPerClient limits concurrent API downloads per client IP; extra requests wait (0 = unlimited).
+	MaxJobsPerClient int
+	// MaxQueuedPerClient caps the requests of a client waiting for a job slot, the rest get 429
+	// (0 = unlimited).
+	MaxQueuedPerClient int
+	// IPPerMinute limits the downloads and playlists each client IP can start per minute, with
+	// bursts of up to IPBurst (0 = unlimited; IPBurst 0 = IPPerMinute).
+	IPPerMinute int
+	IPBurst     int
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For tells the client IP.
+	TrustedProxies []netip.Prefix
+	// MaxBodyBytes caps API request bodies (defaults to 64 KiB).
+	MaxBodyBytes int64
+	// ShutdownTimeout is how long Run lets running downloads and jobs finish when stopping
+	// before it cancels them (defaults to 30s).
+	ShutdownTimeout time.Duration
+	clientJobs      *throttle.KeyedLimiter
+	ipRates         *throttle.KeyedBuckets
+	// APIKeys lock the API: clients send one in the X-API-Key header, as a bearer token or
+	// in the api_key query parameter (empty = open API).
+	APIKeys []APIKey
+	// KeyPerMinute and KeyPerDay limit the keys that don't set their own limits (0 = unlimited).
+	KeyPerMinute int
+	KeyPerDay    int
+	// AdminKey unlocks GET /api/admin/usage (empty = no admin endpoint).
+	AdminKey string
+	// FilesNeedKey makes /files/ require an API key as well.
+	FilesNeedKey bool
+	// URLSecrets sign the /files/ links handed out, which then expire after URLTTL (defaults
+	// to an hour). The first secret signs, all of them verify (empty = plain links).
+	URLSecrets []string
+	URLTTL     time.Duration
+	keys       *keyRing
+	signer     *urlSigner
+	// running counts requests and playlist jobs in progress; stopping ends when shutdown begins.
+	running         sync.WaitGroup
+	stopping        context.Context
 	mu              sync.Mutex
 	activeDownloads map[string]int
+	lastServed      map[string]time.Time
+	// redirected keeps files handed out as signed storage URLs busy until the URLs expire,
+	// since the server doesn't see those downloads end.
+	redirected map[string]time.Time
+	jobsMu     sync.Mutex
+	jobs       map[string]*batchJob
 }
 
+// Start serves until the process exits, see Run.
 func (s *Server) Start(enableWeb bool) error {
+	return s.Run(context.Background(), enableWeb)
+}
+
+// Run serves until ctx is cancelled, then shuts down gracefully: it stops accepting requests
+// and starting playlist videos, waits up to ShutdownTimeout for the running ones and then
+// cancels them, killing ffmpeg. Work files left by an interrupted run are deleted on start.
+func (s *Server) Run(ctx context.Context, enableWeb bool) error {
+	if n := s.Downloader.SweepTemp(); n > 0 {
+		slog.Info("Removed leftovers of an interrupted run", "count", n)
+	}
+	abortCtx, abort := context.WithCancel(context.Background())
+	defer abort()
+	s.Downloader.Context = abortCtx
+	s.stopping = ctx
+
+	// Over quota, make room by dropping the files nobody has asked for lately.
+	if s.Downloader.Evict == nil {
+		s.Downloader.Evict = s.evictLeastRecentlyServed
+	}
+	if s.Gateway.Busy == nil {
+		s.Gateway.Busy = s.isFileBusy
+	}
+
+	s.clientJobs = throttle.NewKeyedLimiter(s.MaxJobsPerClient)
+	burst := s.IPBurst
+	if burst <= 0 {
+		burst = s.IPPerMinute
+	}
+	s.ipRates = throttle.NewKeyedBuckets(float64(s.IPPerMinute)/60, float64(burst))
+	s.jobs = make(map[string]*batchJob)
+	s.keys = newKeyRing(s.APIKeys, s.KeyPerMinute, s.KeyPerDay)
+	s.signer = newURLSigner(s.URLSecrets)
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/api/download", s.handleAPIDownload)
-	mux.HandleFunc("/files/", s.handleFileDownload)
+	mux.HandleFunc("/api/download", s.limitIP(s.requireKey(s.handleAPIDownload, true)))
+	mux.HandleFunc("/api/playlist", s.limitIP(s.requireKey(s.handlePlaylist, true)))
+	mux.HandleFunc("/api/jobs/", s.requireKey(s.handleJob, false))
+	mux.HandleFunc("/files/", s.authorizeFile(s.handleFileDownload))
+	if s.AdminKey != "" {
+		mux.HandleFunc("/api/admin/usage", s.handleUsage)
+	}
 
 	if enableWeb {
 		mux.HandleFunc("/", s.handleWebIndex)
@@ -38,8 +137,61 @@ func (s *Server) Start(enableWeb bool) error {
 
 	addr := fmt.Sprintf(":%d", s.Port)
 	fullAddr := fmt.Sprintf("http://localhost:%d", s.Port)
-	slog.Info("Starting API server", "addr", fullAddr, "web_ui", enableWeb)
-	return http.ListenAndServe(addr, mux)
+	slog.Info("Starting API server", "addr", fullAddr, "web_ui", enableWeb, "api_keys", len(s.APIKeys), "signed_links", s.signer != nil)
+	// slow clients can't hold connections open forever before sending a request
+	srv := &http.Server{Addr: addr, Handler: s.track(mux), ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := s.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	slog.Info("Shutting down, waiting for running downloads", "timeout", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_ = srv.Shutdown(shutdownCtx)
+	if !waitFor(shutdownCtx, &s.running) {
+		slog.Warn("Shutdown timeout reached, cancelling running downloads")
+		abort()
+		_ = srv.Close()
+		graceCtx, cancelGrace := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancelGrace()
+		if !waitFor(graceCtx, &s.running) {
+			slog.Error("Running downloads did not stop")
+		}
+	}
+	slog.Info("API server stopped")
+	return nil
+}
+
+// track counts the requests in progress, so Run can wait for them when stopping.
+func (s *Server) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.running.Add(1)
+		defer s.running.Done()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// waitFor waits for wg until ctx is done and reports whether wg finished.
+func waitFor(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 func (s *Server) handleAPIDownload(w http.ResponseWriter, r *http.Request) {
@@ -50,11 +202,80 @@ func (s *Server) handleAPIDownload(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		URL string `json:"url"`
+		// Start/End cut a time range ("90", "1:30", "1m30s"). With ClipFromURL they default to
+		// t=/start=/end= in the URL, which otherwise are ignored like any shared timestamp.
+		Start       string `json:"start"`
+		End         string `json:"end"`
+		ClipFromURL bool   `json:"clip_from_url"`
+		Accurate    bool   `json:"accurate"`
+		// ThumbnailAt grabs the thumbnail from the video at this time instead of YouTube's image.
+		ThumbnailAt  string `json:"thumbnail_at"`
+		ContactSheet bool   `json:"contact_sheet"`
+		// Animation ("gif" or "webp") returns an animated image of start/end instead of the video.
+		Animation string  `json:"animation"`
+		Width     int     `json:"width"`
+		FPS       float64 `json:"fps"`
+		// Subtitles lists caption languages to save ("en,de", "any"); embed/burn add them to the video.
+		Subtitles       string `json:"subtitles"`
+		SubtitlesFormat string `json:"subtitles_format"`
+		SubtitlesAuto   bool   `json:"subtitles_auto"`
+		SubtitlesEmbed  bool   `json:"subtitles_embed"`
+		SubtitlesBurn   bool   `json:"subtitles_burn"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+
+	clip := ffmpeg.ClipOptions{Accurate: req.Accurate}
+	if req.ClipFromURL {
+		clip.Start, clip.End = utils.ExtractTimeRange(req.URL)
+	}
+	var terr error
+	if req.Start != "" {
+		clip.Start, terr = utils.ParseTimestamp(req.Start)
+	}
+	if req.End != "" && terr == nil {
+		clip.End, terr = utils.ParseTimestamp(req.End)
+	}
+	thumb := gateway.ThumbnailOptions{ContactSheet: req.ContactSheet}
+	if req.ThumbnailAt != "" && terr == nil {
+		thumb.FromVideo = true
+		thumb.At, terr = utils.ParseTimestamp(req.ThumbnailAt)
+	}
+	var anim *ffmpeg.AnimationOptions
+	if req.Animation != "" && terr == nil {
+		anim = &ffmpeg.AnimationOptions{Format: req.Animation, Width: req.Width, FPS: req.FPS, Start: clip.Start, End: clip.End}
+		terr = anim.Normalize()
+	}
+	var subs *gateway.SubtitleOptions
+	if req.Subtitles != "" && terr == nil {
+		subs = &gateway.SubtitleOptions{
+			Languages: gateway.ParseSubtitleLanguages(req.Subtitles),
+			Format:    req.SubtitlesFormat,
+			Auto:      req.SubtitlesAuto,
+			Embed:     req.SubtitlesEmbed,
+			Burn:      req.SubtitlesBurn,
+		}
+		terr = subs.Validate()
+	}
+	// the bundled nano ffmpeg only remuxes, don't download anything for what it can't do
+	if thumb.FromVideo && terr == nil {
+		terr = s.Downloader.Muxer().SupportsFrame()
+	}
+	if thumb.ContactSheet && terr == nil {
+		terr = s.Downloader.Muxer().SupportsContactSheet()
+	}
+	if anim != nil && terr == nil {
+		terr = s.Downloader.Muxer().SupportsAnimation(anim.Format)
+	}
+	if subs != nil && (subs.Embed || subs.Burn) && terr == nil {
+		terr = s.Downloader.Muxer().SupportsSubtitles(subs.Burn)
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if terr != nil {
+		s.respondJSON(w, errorResponse(terr))
 		return
 	}
+	addSubs := subs != nil && (subs.Embed || subs.Burn)
 
 	vidID := utils.ExtractVideoID(req.URL)
 	if vidID == "" {
@@ -63,8 +284,44 @@ func (s *Server) handleAPIDownload(w http.ResponseWriter, r *http.Request) {
 	}
 	fullURL := "https://www.youtube.com/watch?v=" + vidID
 
-	slog.Info("API request received", "vid", vidID, "remote", r.RemoteAddr)
+	client := s.clientIP(r)
+	slog.Info("API request received", "vid", vidID, "client", client)
+	slot, ok := s.reserveJob(w, client)
+	if !ok {
+		return
+	}
+
+	refund, ok := s.takeQuota(w, r, 1)
+	if !ok {
+		slot.Cancel()
+		return
+	}
+	// only successful downloads count against the quota
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			refund(1)
+		}
+	}()
+
+	release, ok := slot.TryAcquire()
+	if !ok {
+		slog.Info("Client job limit reached, request queued", "client", client)
+		var err error
+		release, err = slot.Acquire(r.Context())
+		if err != nil {
+			slog.Info("Client gave up while queued", "client", client, "err", err)
+			return
+		}
+	}
+	defer release()
 
+	// a plain direct_url answer doesn't wait for the metadata, a download looks it up during the race
+	forced := !clip.IsZero() || anim != nil || thumb.FromVideo || thumb.ContactSheet || addSubs
+	var metadata func() *models.VideoMetadata
+	if s.Gateway.NeedsMetadata(nil, forced) {
+		metadata = s.Gateway.FetchMetadata(vidID)
+	}
 	res, provName, err := s.Gateway.GetLinkWithRetries(fullURL)
 	if err != nil {
 		slog.Error("Processing failed", "vid", vidID, "err", err)
@@ -72,56 +329,144 @@ func (s *Server) handleAPIDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	res.VideoID = vidID
+	if metadata == nil && s.Gateway.NeedsMetadata(res, forced || res.NeedsMuxing) {
+		metadata = s.Gateway.FetchMetadata(vidID)
+	}
+	if metadata != nil {
+		s.Gateway.ApplyMetadata(res, metadata())
+	}
 
 	response := models.APIResponse{
-		Success: true,
-		Title:   res.Title,
-		VideoID: vidID,
+		Success:  true,
+		Title:    res.Title,
+		VideoID:  vidID,
+		Metadata: res.Metadata,
 	}
 
-	if res.NeedsMuxing {
-		slog.Info("Muxing required for API", "provider", provName)
-		localPath, err := s.Downloader.DownloadAndMux(res)
+	var localPath string
+	if res.NeedsMuxing || forced {
+		slog.Info("Download required for API", "provider", provName, "mux", res.NeedsMuxing, "clip", !clip.IsZero())
+		if lerr := s.Gateway.CheckLimits(res); lerr != nil {
+			slog.Info("Video rejected", "vid", vidID, "err", lerr)
+			s.respondJSON(w, errorResponse(lerr))
+			return
+		}
+		res, localPath, err = s.Gateway.DownloadWithFallback(fullURL, res, provName)
 		if err != nil {
 			slog.Error("Download/Mux failed", "err", err)
 			s.respondJSON(w, models.APIResponse{Success: false, Error: err.Error()})
 			return
 		}
+		if subs != nil {
+			if serr := s.Gateway.Subtitles(localPath, res, *subs); serr != nil {
+				if addSubs {
+					slog.Error("Failed to add subtitles", "vid", vidID, "err", serr)
+					s.respondJSON(w, errorResponse(serr))
+					return
+				}
+				slog.Warn("Failed to save subtitles", "vid", vidID, "err", serr)
+			}
+		}
+		if !clip.IsZero() && anim == nil {
+			localPath, err = s.Gateway.Clip(localPath, res, clip)
+			if err != nil {
+				slog.Error("Clip failed", "err", err)
+				s.respondJSON(w, models.APIResponse{Success: false, Error: err.Error()})
+				return
+			}
+		}
 
-		filename := filepath.Base(localPath)
-		response.LocalPath, _ = filepath.Abs(localPath)
-		response.StreamURL = fmt.Sprintf("%s/files/%s", s.Host, filename)
+		response.StreamURL = s.fileURL(localPath)
+		response.Media = res.Media
 	} else {
 		response.DirectURL = res.DownloadURL
+		if subs != nil {
+			if serr := s.Gateway.Subtitles("", res, *subs); serr != nil {
+				slog.Warn("Failed to save subtitles", "vid", vidID, "err", serr)
+			}
+		}
+	}
+
+	if terr := s.Gateway.Thumbnail(localPath, res, thumb); terr != nil {
+		slog.Warn("Failed to create preview images", "vid", vidID, "err", terr)
+	}
+
+	if anim != nil {
+		localPath, err = s.Gateway.Animate(localPath, res, *anim)
+		if err != nil {
+			slog.Error("Animation failed", "err", err)
+			s.respondJSON(w, models.APIResponse{Success: false, Error: err.Error()})
+			return
+		}
+		response.StreamURL = s.fileURL(localPath)
+		response.Media = res.Media
+	}
+
+	if res.ThumbnailPath != "" {
+		response.ThumbnailURL = s.fileURL(res.ThumbnailPath)
+	}
+	if res.ContactSheetPath != "" {
+		response.ContactSheetURL = s.fileURL(res.ContactSheetPath)
+	}
+
+	scratch := []string{localPath, res.ThumbnailPath, res.ContactSheetPath}
+	for _, sub := range res.Subtitles {
+		response.Subtitles = append(response.Subtitles, models.Subtitle{Language: sub.Language, Auto: sub.Auto, URL: s.fileURL(sub.Path)})
+		scratch = append(scratch, sub.Path)
+	}
+
+	if storage.IsLocal(s.Downloader.Storage) {
+		if localPath != "" {
+			response.LocalPath, _ = filepath.Abs(localPath)
+		}
+	} else {
+		removeLocalCopies(scratch...)
 	}
 
+	succeeded = true
 	s.respondJSON(w, response)
 }
 
 func (s *Server) handleFileDownload(w http.ResponseWriter, r *http.Request) {
 	filename := strings.TrimPrefix(r.URL.Path, "/files/")
-	if filename == "" || strings.Contains(filename, "..") || strings.Contains(filename, "/") {
+	if !storage.ValidName(filename) {
 		http.Error(w, "Invalid filename", http.StatusBadRequest)
 		return
 	}
 
-	path := filepath.Join(s.Downloader.OutputDir, filename)
-
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	store := s.Downloader.Storage
+	info, err := store.Stat(filename)
+	if errors.Is(err, fs.ErrNotExist) {
 		http.Error(w, "File not found or expired", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		slog.Error("Storage stat failed", "file", filename, "err", err)
+		http.Error(w, "File access error", http.StatusInternalServerError)
+		return
+	}
+
+	if signer, ok := store.(storage.Signer); ok {
+		signedURL, serr := signer.SignedURL(filename, signedURLTTL)
+		if serr == nil {
+			s.trackRedirect(filename)
+			slog.Info("Redirecting to signed storage URL", "file", filename, "remote", r.RemoteAddr)
+			http.Redirect(w, r, signedURL, http.StatusFound)
+			return
+		}
+		slog.Warn("Failed to sign storage URL, proxying instead", "file", filename, "err", serr)
+	}
 
 	s.trackFileStart(filename)
 
 	defer s.trackFileEnd(filename)
 
-	file, err := os.Open(path)
+	file, err := store.Open(filename)
 	if err != nil {
 		http.Error(w, "File access error", http.StatusInternalServerError)
 		return
 	}
-	defer func(file *os.File) {
+	defer func(file io.Closer) {
 		cerr := file.Close()
 		if cerr != nil {
 			slog.Error("Error closing file", "err", cerr)
@@ -130,23 +475,32 @@ func (s *Server) handleFileDownload(w http.ResponseWriter, r *http.Request) {
 
 	slog.Info("Serving file via API", "file", filename, "remote", r.RemoteAddr)
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	http.ServeContent(w, r, filename, time.Now(), file)
+	w.Header().Set("Content-Disposition", contentDisposition(path.Base(filename)))
+	http.ServeContent(w, r, filename, info.ModTime, file)
 }
 
-func (s *Server) BackgroundCleaner(ttl time.Duration) {
+// BackgroundCleaner deletes files older than ttl and forgets old jobs every minute until ctx is cancelled.
+func (s *Server) BackgroundCleaner(ctx context.Context, ttl time.Duration) {
 	ticker := time.NewTicker(1 * time.Minute)
-	for range ticker.C {
-		files, err := os.ReadDir(s.Downloader.OutputDir)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		s.pruneJobs()
+
+		files, err := s.Downloader.Storage.List()
 		if err != nil {
-			slog.Error("Cleaner cant read dir", "err", err)
+			slog.Error("Cleaner cant list storage", "err", err)
 			continue
 		}
 
 		for _, f := range files {
-			name := f.Name()
+			name := f.Name
 
-			if strings.Contains(name, "_tmp") || strings.HasSuffix(name, ".part") {
+			if storage.IsTemp(name) {
 				continue
 			}
 
@@ -155,13 +509,12 @@ func (s *Server) BackgroundCleaner(ttl time.Duration) {
 				continue
 			}
 
-			info, _ := f.Info()
-			if time.Since(info.ModTime()) > ttl {
-				fullPath := filepath.Join(s.Downloader.OutputDir, name)
-				err := os.Remove(fullPath)
+			if f.Age() > ttl {
+				err := s.Downloader.Storage.Delete(name)
 				if err != nil {
 					slog.Error("Failed to remove file", "err", err)
 				} else {
+					s.forgetFile(name)
 					slog.Debug("Cleaned up old file", "file", name)
 				}
 			}
@@ -172,6 +525,9 @@ func (s *Server) BackgroundCleaner(ttl time.Duration) {
 func (s *Server) trackFileStart(filename string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.activeDownloads == nil {
+		s.activeDownloads = make(map[string]int)
+	}
 	s.activeDownloads[filename]++
 }
 
@@ -182,14 +538,98 @@ func (s *Server) trackFileEnd(filename string) {
 	if s.activeDownloads[filename] <= 0 {
 		delete(s.activeDownloads, filename)
 	}
+	if s.lastServed == nil {
+		s.lastServed = make(map[string]time.Time)
+	}
+	s.lastServed[filename] = time.Now()
 }
 
-func (s *Server) isFileBusy(filename string) bool {
+// trackRedirect marks a file as served and busy for as long as its signed URL is valid.
+// A download that is still running when the URL expires can lose its file.
+func (s *Server) trackRedirect(filename string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.redirected == nil {
+		s.redirected = make(map[string]time.Time)
+	}
+	if s.lastServed == nil {
+		s.lastServed = make(map[string]time.Time)
+	}
+	now := time.Now()
+	s.redirected[filename] = now.Add(signedURLTTL)
+	s.lastServed[filename] = now
+}
+
+// busyLocked reports whether a file is being downloaded; s.mu must be held.
+func (s *Server) busyLocked(filename string) bool {
+	if until, ok := s.redirected[filename]; ok {
+		if time.Now().Before(until) {
+			return true
+		}
+		delete(s.redirected, filename)
+	}
 	return s.activeDownloads[filename] > 0
 }
 
+// evictLeastRecentlyServed deletes idle files, least recently served first
+// (never served ones by age), until at least need bytes are freed.
+func (s *Server) evictLeastRecentlyServed(need int64) int64 {
+	files, err := s.Downloader.Storage.List()
+	if err != nil {
+		slog.Error("Eviction cant list storage", "err", err)
+		return 0
+	}
+
+	s.mu.Lock()
+	lastUse := func(f storage.FileInfo) time.Time {
+		if t, ok := s.lastServed[f.Name]; ok && t.After(f.ModTime) {
+			return t
+		}
+		return f.ModTime
+	}
+	candidates := files[:0]
+	for _, f := range files {
+		if storage.IsTemp(f.Name) || s.busyLocked(f.Name) {
+			continue
+		}
+		candidates = append(candidates, f)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return lastUse(candidates[i]).Before(lastUse(candidates[j]))
+	})
+	s.mu.Unlock()
+
+	var freed int64
+	for _, f := range candidates {
+		if freed >= need {
+			break
+		}
+		if s.isFileBusy(f.Name) {
+			continue
+		}
+		if err := s.Downloader.Storage.Delete(f.Name); err != nil {
+			slog.Error("Failed to evict file", "file", f.Name, "err", err)
+			continue
+		}
+		s.forgetFile(f.Name)
+		freed += f.Size
+		slog.Info("Evicted file to free space", "file", f.Name, "size_mb", f.Size/1024/1024)
+	}
+	return freed
+}
+
+func (s *Server) forgetFile(filename string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.lastServed, filename)
+}
+
+func (s *Server) isFileBusy(filename string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.busyLocked(filename)
+}
+
 func (s *Server) handleWebIndex(w http.ResponseWriter, r *http.Request) {
 
 	t, _ := template.New("index").Parse(tmpl)
@@ -199,6 +639,67 @@ func (s *Server) handleWebIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// fileURL is the /files/ link for a local file in the output directory, signed if URLSecrets are set.
+func (s *Server) fileURL(localPath string) string {
+	name := s.Downloader.StorageName(localPath)
+	segments := strings.Split(name, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	link := fmt.Sprintf("%s/files/%s", s.Host, strings.Join(segments, "/"))
+	if s.signer == nil {
+		return link
+	}
+	ttl := s.URLTTL
+	if ttl <= 0 {
+		ttl = defaultURLTTL
+	}
+	return link + "?" + s.signer.sign(name, time.Now().Add(ttl)).Encode()
+}
+
+// contentDisposition offers the file under its own name; non-ASCII names are sent
+// as RFC 5987 filename* with an ASCII fallback for old clients.
+func contentDisposition(name string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+	if fallback == name {
+		return fmt.Sprintf("attachment; filename=\"%s\"", name)
+	}
+	return fmt.Sprintf("attachment; filename=\"%s\"; filename*=UTF-8''%s", fallback, strings.ReplaceAll(url.QueryEscape(name), "+", "%20"))
+}
+
+// removeLocalCopies deletes scratch copies of files that now live in remote storage.
+func removeLocalCopies(paths ...string) {
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to remove local copy of stored file", "path", p, "err", err)
+		}
+	}
+}
+
+// CodeUnsupported rejects requests for features the server's ffmpeg build lacks.
+const CodeUnsupported = "unsupported"
+
+// errorResponse reports err, with its code when it is a rejection by the gateway limits
+// or a feature the ffmpeg build lacks.
+func errorResponse(err error) models.APIResponse {
+	resp := models.APIResponse{Success: false, Error: err.Error()}
+	var lerr *gateway.LimitError
+	if errors.As(err, &lerr) {
+		resp.Code = lerr.Code
+	} else if errors.Is(err, ffmpeg.ErrUnsupported) {
+		resp.Code = CodeUnsupported
+	}
+	return resp
+}
+
 func (s *Server) respondJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	jerr := json.NewEncoder(w).Encode(data)
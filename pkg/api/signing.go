@@ -0,0 +1,108 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultURLTTL is how long signed /files/ links stay valid, by default.
+const defaultURLTTL = time.Hour
+
+var (
+	errLinkInvalid = errors.New("invalid link signature")
+	errLinkExpired = errors.New("link expired")
+)
+
+// urlSigner signs /files/ links with an expiry: ?exp=<unix>&kid=<key id>&sig=<HMAC>.
+// The first secret signs, all of them verify, so secrets can be rotated without
+// breaking the links already handed out.
+type urlSigner struct {
+	secrets [][]byte
+	ids     []string
+}
+
+func newURLSigner(secrets []string) *urlSigner {
+	if len(secrets) == 0 {
+		return nil
+	}
+	u := &urlSigner{}
+	for _, secret := range secrets {
+		sum := sha256.Sum256([]byte(secret))
+		u.secrets = append(u.secrets, []byte(secret))
+		u.ids = append(u.ids, hex.EncodeToString(sum[:4]))
+	}
+	return u
+}
+
+func mac(secret []byte, name string, exp int64) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(name + "\n" + strconv.FormatInt(exp, 10)))
+	return h.Sum(nil)
+}
+
+// sign returns the query parameters that make the link to the stored file name valid until exp.
+func (u *urlSigner) sign(name string, exp time.Time) url.Values {
+	q := url.Values{}
+	q.Set("exp", strconv.FormatInt(exp.Unix(), 10))
+	q.Set("kid", u.ids[0])
+	q.Set("sig", base64.RawURLEncoding.EncodeToString(mac(u.secrets[0], name, exp.Unix())))
+	return q
+}
+
+// verify checks the signature of a link to name and that it hasn't expired.
+func (u *urlSigner) verify(name string, q url.Values, now time.Time) error {
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil {
+		return errLinkInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(q.Get("sig"))
+	if err != nil {
+		return errLinkInvalid
+	}
+	for i, id := range u.ids {
+		if id != q.Get("kid") {
+			continue
+		}
+		if !hmac.Equal(sig, mac(u.secrets[i], name, exp)) {
+			return errLinkInvalid
+		}
+		if now.Unix() > exp {
+			return errLinkExpired
+		}
+		return nil
+	}
+	return errLinkInvalid
+}
+
+// authorizeFile guards /files/. With URL secrets a download needs a valid signed link or an
+// API key; otherwise it needs an API key only with FilesNeedKey.
+func (s *Server) authorizeFile(next http.HandlerFunc) http.HandlerFunc {
+	keyed := s.requireKey(next, false)
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case s.signer == nil && s.FilesNeedKey:
+			keyed(w, r)
+		case s.signer == nil:
+			next(w, r)
+		case r.URL.Query().Has("sig"):
+			name := strings.TrimPrefix(r.URL.Path, "/files/")
+			if err := s.signer.verify(name, r.URL.Query(), time.Now()); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			next(w, r)
+		case requestKey(r) != "" && len(s.keys.bySecret) > 0:
+			keyed(w, r)
+		default:
+			http.Error(w, "Signed link required", http.StatusForbidden)
+		}
+	}
+}
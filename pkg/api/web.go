@@ -21,6 +21,7 @@ var tmpl = `
         a { display: inline-block; margin: 5px; color: #4ea8de; text-decoration: none; border: 1px solid #4ea8de; padding: 5px 10px; border-radius: 4px; font-size: 0.9rem; }
         a:hover { background: #4ea8de; color: #fff; }
         .error { color: var(--accent); font-size: 0.9rem; }
+        .thumb { width: 100%; border-radius: 6px; margin-bottom: 10px; }
     </style>
 </head>
 <body>
@@ -37,6 +38,8 @@ var tmpl = `
         const f = document.getElementById('dlForm'), 
               r = document.getElementById('result'),
               b = document.getElementById('btn');
+        // servers with API keys: asked for on the first 401, kept for this tab only
+        let key = sessionStorage.getItem('api_key');
 
         f.onsubmit = async (e) => {
             e.preventDefault();
@@ -44,17 +47,29 @@ var tmpl = `
             r.innerHTML = '⏳ Processing...';
             
             try {
-                const resp = await fetch('/api/download', {
+                const send = () => fetch('/api/download', {
                     method: 'POST',
-                    headers: {'Content-Type': 'application/json'},
+                    headers: Object.assign({'Content-Type': 'application/json'}, key ? {'X-API-Key': key} : {}),
                     body: JSON.stringify({url: document.getElementById('url').value})
                 });
+                let resp = await send();
+                if (resp.status === 401) {
+                    sessionStorage.removeItem('api_key');
+                    key = prompt('API key:');
+                    if (key) {
+                        sessionStorage.setItem('api_key', key);
+                        resp = await send();
+                    }
+                }
                 const data = await resp.json();
                 
                 if (!data.success) throw new Error(data.error);
-                let html = '<div style="font-weight:bold;margin-bottom:10px">' + data.title + '</div>';
+                let html = '';
+                if (data.thumbnail_url) html += '<img class="thumb" src="' + data.thumbnail_url + '" alt="">';
+                html += '<div style="font-weight:bold;margin-bottom:10px">' + data.title + '</div>';
                 if (data.direct_url) html += '<a href="' + data.direct_url + '" target="_blank">📥 Direct Link</a>';
                 if (data.stream_url) html += '<a href="' + data.stream_url + '" target="_blank">🎬 Stream Link</a>';
+                if (data.thumbnail_url) html += '<a href="' + data.thumbnail_url + '" target="_blank">🖼 Thumbnail</a>';
                 r.innerHTML = html;
 
             } catch (err) {
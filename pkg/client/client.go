@@ -27,6 +27,8 @@ func (w *tlsWrapper) Do(req *http.Request) (*http.Response, error) {
 		ContentLength: req.ContentLength,
 		Host:          req.Host,
 	}
+	// cancelling the request's context aborts the transfer, also while the body is read
+	fReq = fReq.WithContext(req.Context())
 
 	for k, v := range req.Header {
 		fReq.Header[k] = v
@@ -0,0 +1,159 @@
+// Package config fills command-line flags from a YAML file and YTGW_* environment variables.
+//
+// Each setting is a flag under its own name: "max-duration: 2h" in the file or
+// YTGW_MAX_DURATION=2h in the environment. Flags that aren't settings only come from
+// the command line. Nested maps are joined with "-", so
+//
+//	s3:
+//	  endpoint: https://s3.example.com
+//
+// sets -s3-endpoint. Lists become comma-separated values. Flags given on the
+// command line win over the environment, which wins over the file.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the environment variables that set flags.
+const EnvPrefix = "YTGW_"
+
+// FileEnv names the environment variable with the path of the config file.
+const FileEnv = EnvPrefix + "CONFIG"
+
+// ConfigFlag is the flag with the path of the config file, it is never read from the file itself.
+const ConfigFlag = "config"
+
+// Source is where the value of a flag came from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// EnvName returns the environment variable for a flag, e.g. YTGW_MAX_DURATION for max-duration.
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Find returns the config file to use: explicit if set, else $YTGW_CONFIG, else the first of
+// ./yt-gateway.yaml, ./yt-gateway.yml and <user config dir>/yt-gateway/config.yaml that exists.
+// It returns "" if there is none.
+func Find(explicit string) string {
+	if explicit != "" {
+		return explicit
+	}
+	if env := os.Getenv(FileEnv); env != "" {
+		return env
+	}
+	candidates := []string{"yt-gateway.yaml", "yt-gateway.yml"}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "yt-gateway", "config.yaml"))
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c
+		}
+	}
+	return ""
+}
+
+// LoadFile reads a YAML config file into flag name -> value.
+func LoadFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	values := make(map[string]string)
+	if err := flatten("", doc, values); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+func flatten(prefix string, doc map[string]any, values map[string]string) error {
+	for key, v := range doc {
+		name := strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+		if prefix != "" {
+			name = prefix + "-" + name
+		}
+		switch v := v.(type) {
+		case nil:
+		case map[string]any:
+			if err := flatten(name, v, values); err != nil {
+				return err
+			}
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				if _, ok := item.(map[string]any); ok {
+					return fmt.Errorf("%s: lists can only hold plain values", name)
+				}
+				items[i] = fmt.Sprint(item)
+			}
+			values[name] = strings.Join(items, ",")
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// Unknown returns the settings in values that are not among known, sorted.
+func Unknown(values map[string]string, known map[string]bool) []string {
+	var unknown []string
+	for name := range values {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// Apply sets every flag of fs (already parsed) that is among settings and wasn't given on the
+// command line from its environment variable or else from values, and reports where each
+// flag's value came from.
+func Apply(fs *flag.FlagSet, values map[string]string, settings map[string]bool) (map[string]Source, error) {
+	sources := make(map[string]Source)
+	fs.Visit(func(f *flag.Flag) { sources[f.Name] = SourceFlag })
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if sources[f.Name] == SourceFlag || f.Name == ConfigFlag {
+			return
+		}
+		sources[f.Name] = SourceDefault
+		if !settings[f.Name] {
+			return
+		}
+
+		value, source := values[f.Name], SourceFile
+		if env, ok := os.LookupEnv(EnvName(f.Name)); ok {
+			value, source = env, SourceEnv
+		} else if _, ok := values[f.Name]; !ok {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s value %q for -%s: %w", source, value, f.Name, err))
+			return
+		}
+		sources[f.Name] = source
+	})
+	return sources, errors.Join(errs...)
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	data := "out: /file/out\ntimeout: 30\nport: 9000\ns3:\n  bucket: file-bucket\nstart: \"1:00\"\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	values, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(EnvName("out"), "/env/out")
+	t.Setenv(EnvName("timeout"), "45")
+	t.Setenv(EnvName("split"), "10m")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.String(ConfigFlag, "", "")
+	fs.String("out", "./downloads", "")
+	fs.Int("timeout", 60, "")
+	fs.Int("port", 8080, "")
+	fs.String("s3-bucket", "", "")
+	fs.String("ffmpeg", "ffmpeg", "")
+	fs.String("start", "", "")
+	fs.String("split", "", "")
+	if err := fs.Parse([]string{"-timeout", "90"}); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := map[string]bool{"out": true, "timeout": true, "port": true, "s3-bucket": true, "ffmpeg": true}
+	sources, err := Apply(fs, values, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		value  string
+		source Source
+	}{
+		{"timeout", "90", SourceFlag},  // flag over env and file
+		{"out", "/env/out", SourceEnv}, // env over file
+		{"port", "9000", SourceFile},   // file over default
+		{"s3-bucket", "file-bucket", SourceFile},
+		{"ffmpeg", "ffmpeg", SourceDefault},
+		{"start", "", SourceDefault}, // not a setting: the file is ignored
+		{"split", "", SourceDefault}, // not a setting: the env is ignored
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fs.Lookup(tt.name).Value.String(); got != tt.value {
+				t.Errorf("value = %q, want %q", got, tt.value)
+			}
+			if sources[tt.name] != tt.source {
+				t.Errorf("source = %q, want %q", sources[tt.name], tt.source)
+			}
+		})
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	t.Setenv(EnvName("timeout"), "soon")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("timeout", 60, "")
+	_ = fs.Parse(nil)
+	if _, err := Apply(fs, nil, map[string]bool{"timeout": true}); err == nil {
+		t.Fatal("expected an error for an invalid env value")
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	values := map[string]string{"out": "x", "start": "1:00", "bogus": "1"}
+	got := Unknown(values, map[string]bool{"out": true})
+	if len(got) != 2 || got[0] != "bogus" || got[1] != "start" {
+		t.Errorf("Unknown = %v, want [bogus start]", got)
+	}
+}
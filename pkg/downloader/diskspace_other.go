@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package downloader
+
+import "errors"
+
+func freeSpace(string) (int64, error) {
+	return 0, errors.New("free space check not supported on this platform")
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package downloader
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the number of bytes available to the current user on the volume holding dir.
+func freeSpace(dir string) (int64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var avail, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &avail, &total, &free); err != nil {
+		return 0, err
+	}
+	return int64(avail), nil
+}
@@ -1,18 +1,24 @@
 package downloader
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/imbecility/yt-gateway/pkg/ffmpeg"
 	"github.com/imbecility/yt-gateway/pkg/models"
 	"github.com/imbecility/yt-gateway/pkg/providers"
+	"github.com/imbecility/yt-gateway/pkg/storage"
+	"github.com/imbecility/yt-gateway/pkg/throttle"
 )
 
 type Downloader struct {
@@ -20,6 +26,50 @@ type Downloader struct {
 	FFmpegPath   string
 	OutputDir    string
 	ShowProgress bool
+	// Storage receives finished files; OutputDir is then only a scratch area.
+	// Nil keeps files in OutputDir only.
+	Storage storage.Storage
+	// MaxFileSize caps a single output file in bytes (0 = unlimited).
+	MaxFileSize int64
+	// Quota caps the total size of files in Storage in bytes (0 = unlimited).
+	Quota int64
+	// Evict is called when space runs out; it should delete unused files
+	// to free at least need bytes and return how much was actually freed.
+	Evict func(need int64) int64
+	// Jobs limits how many DownloadAndMux calls (downloads plus ffmpeg) and other ffmpeg jobs
+	// (see AcquireJob) run at once; nil = unlimited.
+	Jobs *throttle.Semaphore
+	// Bandwidth is shared by all streams of all downloads; nil = unlimited.
+	Bandwidth *throttle.Bucket
+	// EmbedMetadata writes title, channel, source URL, video ID and upload date into the files
+	// (plus the thumbnail as cover art for audio) instead of stripping all metadata.
+	EmbedMetadata bool
+	// FileNameTemplate names the output files, e.g. "{title} [{id}].{ext}" or
+	// "{date}/{channel}/{title}.{ext}" (defaults to DefaultFileNameTemplate).
+	// Names with {id} are overwritten by new downloads of the video, other taken names
+	// get a " (2)" suffix.
+	FileNameTemplate string
+	// Context aborts running downloads and kills ffmpeg when cancelled (nil = never).
+	Context context.Context
+	// spaceMu guards inFlight, the bytes reserved by running downloads.
+	spaceMu  sync.Mutex
+	inFlight int64
+	// names serializes downloads to the same {id} name.
+	namesOnce sync.Once
+	names     *throttle.KeyedLimiter
+}
+
+// Muxer returns an ffmpeg runner bound to the downloader's binary and Context.
+// Clips and parts keep the tags of their source only with EmbedMetadata.
+func (d *Downloader) Muxer() *ffmpeg.Muxer {
+	return &ffmpeg.Muxer{BinaryPath: d.FFmpegPath, Context: d.Context, KeepTags: d.EmbedMetadata}
+}
+
+func (d *Downloader) context() context.Context {
+	if d.Context == nil {
+		return context.Background()
+	}
+	return d.Context
 }
 
 type ProgressWriter struct {
@@ -47,67 +97,118 @@ func (pw *ProgressWriter) printProgress() {
 	if pw.Total > 0 {
 		percent := float64(pw.Downloaded) / float64(pw.Total) * 100
 		totalMb := float64(pw.Total) / 1024 / 1024
-		fmt.Printf("\r[%s] %.2f%% (%.2f/%.2f MB)   ", pw.Type, percent, mb, totalMb)
+		fmt.Fprintf(os.Stderr, "\r[%s] %.2f%% (%.2f/%.2f MB)   ", pw.Type, percent, mb, totalMb)
 	} else {
-		fmt.Printf("\r[%s] Downloading... %.2f MB   ", pw.Type, mb)
+		fmt.Fprintf(os.Stderr, "\r[%s] Downloading... %.2f MB   ", pw.Type, mb)
 	}
 }
 
+// AcquireJob waits for a slot of Jobs. The ffmpeg work done after a download (clips, parts,
+// thumbnails, animations, subtitles) takes one too, so bursts of it can't spawn unbounded encoders.
+// The returned release func must be called exactly once.
+func (d *Downloader) AcquireJob(id string) (func(), error) {
+	if !d.Jobs.TryAcquire() {
+		slog.Info("Job queued, waiting for a free slot", "id", id, "queue", d.Jobs.Waiting()+1)
+		if err := d.Jobs.Acquire(d.context()); err != nil {
+			return nil, err
+		}
+	}
+	return d.Jobs.Release, nil
+}
+
 func (d *Downloader) DownloadAndMux(res *models.VideoResult) (string, error) {
-	fileName := res.VideoID + "." + res.Extension
-	finalPath := filepath.Join(d.OutputDir, fileName)
+	release, err := d.AcquireJob(res.VideoID)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	space := &claim{}
+	defer d.unreserve(space)
+
+	// one lookup for both the file name and the tags
+	if d.EmbedMetadata || strings.Contains(d.FileNameTemplate, "{channel}") || strings.Contains(d.FileNameTemplate, "{date}") {
+		d.lookupDetails(res)
+	}
+	fileName, finalPath, unlock, err := d.reserveName(res)
+	if err != nil {
+		return "", fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer unlock()
 
 	if !res.NeedsMuxing {
 		slog.Debug("Starting direct download", "url", res.DownloadURL)
-		if err := d.downloadFile(res.DownloadURL, finalPath, "File"); err != nil {
+		if err := d.downloadFile(res.DownloadURL, finalPath, "File", d.newBudget(), space); err != nil {
+			if rerr := os.Remove(finalPath); rerr != nil && !os.IsNotExist(rerr) {
+				slog.Error("Error removing partial file", "error", rerr)
+			}
 			return "", err
 		}
 		if d.ShowProgress {
-			fmt.Println()
+			fmt.Fprintln(os.Stderr)
+		}
+		if tags, cleanup := d.tags(res); tags != nil {
+			d.tagFile(finalPath, tags)
+			cleanup()
+		}
+		if err := d.verify(res, finalPath); err != nil {
+			return "", err
+		}
+		if err := d.store(fileName, finalPath); err != nil {
+			return "", err
 		}
 		return finalPath, nil
 	}
 
 	slog.Debug("Starting muxing download", "id", res.VideoID)
-	vidTmp := filepath.Join(d.OutputDir, fmt.Sprintf("%s_vid_tmp.mp4", res.VideoID))
-	audTmp := filepath.Join(d.OutputDir, fmt.Sprintf("%s_aud_tmp.m4a", res.VideoID))
+	// temporary streams are named after the reserved output, so parallel downloads of one video don't clash
+	stem := strings.TrimSuffix(finalPath, filepath.Ext(finalPath))
+	vidTmp := stem + "_vid_tmp.mp4"
+	audTmp := stem + "_aud_tmp.m4a"
 
 	var wg sync.WaitGroup
 	var errVideo, errAudio error
+	budget := d.newBudget()
 
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
-		errVideo = d.downloadFile(res.DownloadURL, vidTmp, "Video")
+		errVideo = d.downloadFile(res.DownloadURL, vidTmp, "Video", budget, space)
 	}()
 
 	go func() {
 		defer wg.Done()
-		errAudio = d.downloadFile(res.AudioURL, audTmp, "Audio")
+		errAudio = d.downloadFile(res.AudioURL, audTmp, "Audio", budget, space)
 	}()
 
 	wg.Wait()
 
 	if d.ShowProgress {
-		fmt.Println()
+		fmt.Fprintln(os.Stderr)
 	}
 
 	if errVideo != nil || errAudio != nil {
 		vfderr := os.Remove(vidTmp)
-		if vfderr != nil {
+		if vfderr != nil && !os.IsNotExist(vfderr) {
 			slog.Error("Error removing video file", "error", vfderr)
 		}
 		afderr := os.Remove(audTmp)
-		if afderr != nil {
+		if afderr != nil && !os.IsNotExist(afderr) {
 			slog.Error("Error removing audio file", "error", afderr)
 		}
-		return "", fmt.Errorf("download failed: video_err=%v, audio_err=%v", errVideo, errAudio)
+		d.release(finalPath)
+		return "", fmt.Errorf("download failed: %w", errors.Join(errVideo, errAudio))
 	}
 
 	slog.Debug("Streams downloaded, starting ffmpeg muxing")
-	muxer := ffmpeg.Muxer{BinaryPath: d.FFmpegPath}
-	if err := muxer.Mux(vidTmp, audTmp, finalPath); err != nil {
-		return "", fmt.Errorf("muxing error: %w", err)
+	tags, cleanup := d.tags(res)
+	err = d.Muxer().MuxWithTags(vidTmp, audTmp, finalPath, tags)
+	cleanup()
+	if err != nil {
+		// a provider serving an error page instead of a stream makes ffmpeg fail here,
+		// report that as broken media so another provider gets a chance
+		if verr := errors.Join(d.Muxer().VerifyStream(vidTmp, "video"), d.Muxer().VerifyStream(audTmp, "audio")); verr != nil {
+			err = verr
+		}
 	}
 
 	vfderr := os.Remove(vidTmp)
@@ -118,22 +219,45 @@ func (d *Downloader) DownloadAndMux(res *models.VideoResult) (string, error) {
 	if afderr != nil {
 		slog.Error("Error removing audio file", "error", afderr)
 	}
+	if err != nil {
+		d.release(finalPath)
+		return "", fmt.Errorf("muxing error: %w", err)
+	}
+	if err := d.verify(res, finalPath); err != nil {
+		return "", err
+	}
+	if err := d.store(fileName, finalPath); err != nil {
+		return "", err
+	}
 	return finalPath, nil
 }
 
-func (d *Downloader) downloadFile(url string, fpath string, streamType string) error {
-	out, err := os.Create(fpath)
+// verify rejects and deletes files that are not playable videos; on success res.Media is filled.
+func (d *Downloader) verify(res *models.VideoResult, path string) error {
+	info, err := d.Muxer().Verify(path)
 	if err != nil {
-		return err
-	}
-	defer func(out *os.File) {
-		ferr := out.Close()
-		if ferr != nil {
-			slog.Error("Error closing file", "error", ferr)
+		if rerr := os.Remove(path); rerr != nil {
+			slog.Error("Error removing broken file", "error", rerr)
 		}
-	}(out)
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	slog.Debug("File verified", "path", path, "duration", info.DurationSec, "codec", info.VideoCodec, "height", info.Height)
+	res.Media = info
+	return nil
+}
 
-	req, _ := http.NewRequest("GET", url, nil)
+func (d *Downloader) store(name, path string) error {
+	if d.Storage == nil {
+		return nil
+	}
+	if err := storage.PutFile(d.Storage, name, path); err != nil {
+		return fmt.Errorf("failed to store file: %w", err)
+	}
+	return nil
+}
+
+func (d *Downloader) downloadFile(url string, fpath string, streamType string, budget *atomic.Int64, space *claim) error {
+	req, _ := http.NewRequestWithContext(d.context(), "GET", url, nil)
 
 	resp, err := d.Client.Do(req)
 	if err != nil {
@@ -150,7 +274,29 @@ func (d *Downloader) downloadFile(url string, fpath string, streamType string) e
 		return fmt.Errorf("http status: %d", resp.StatusCode)
 	}
 
+	if err := d.reserve(resp.ContentLength, space); err != nil {
+		return err
+	}
+
+	out, err := os.Create(fpath)
+	if err != nil {
+		return err
+	}
+	defer func(out *os.File) {
+		ferr := out.Close()
+		if ferr != nil {
+			slog.Error("Error closing file", "error", ferr)
+		}
+	}(out)
+
 	var source io.Reader = resp.Body
+	if budget != nil {
+		source = &capReader{Reader: source, budget: budget}
+	}
+
+	if d.Bandwidth != nil {
+		source = &throttle.Reader{R: source, Bucket: d.Bandwidth}
+	}
 
 	if d.ShowProgress {
 		pw := &ProgressWriter{
@@ -159,7 +305,7 @@ func (d *Downloader) downloadFile(url string, fpath string, streamType string) e
 			LastPrint: time.Now(),
 		}
 		source = &progressReaderWrapper{
-			Reader: resp.Body,
+			Reader: source,
 			Pw:     pw,
 		}
 	}
@@ -0,0 +1,134 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/storage"
+	"github.com/imbecility/yt-gateway/pkg/throttle"
+	"github.com/imbecility/yt-gateway/pkg/utils"
+)
+
+// DefaultFileNameTemplate names files by video ID only.
+const DefaultFileNameTemplate = "{id}.{ext}"
+
+// maxNameCollisions bounds the " (2)", " (3)"... suffixes tried for a taken name.
+const maxNameCollisions = 1000
+
+// FileNameFields are the values available to FileNameTemplate.
+func FileNameFields(res *models.VideoResult) map[string]string {
+	date := res.UploadDate
+	if date == "" {
+		date = "unknown date"
+	}
+	channel := res.Channel
+	if channel == "" {
+		channel = "unknown channel"
+	}
+	return map[string]string{
+		"id":      res.VideoID,
+		"title":   res.Title,
+		"channel": channel,
+		"date":    date,
+		"ext":     res.Extension,
+	}
+}
+
+// ValidateFileNameTemplate reports unknown fields in a template.
+func ValidateFileNameTemplate(tmpl string) error {
+	_, err := utils.ExpandFileNameTemplate(tmpl, FileNameFields(&models.VideoResult{}))
+	return err
+}
+
+// reserveName expands FileNameTemplate for res and claims the name by creating an empty file,
+// so concurrent downloads never write to the same path. Names with {id} belong to one video:
+// downloading it again overwrites the file, after the running download of it has finished
+// (unlock, called when the file is done). Other names, e.g. by title, get the first free
+// " (2)" variant. It returns the storage name (slash-separated, relative to OutputDir) and
+// the local path.
+func (d *Downloader) reserveName(res *models.VideoResult) (name, fpath string, unlock func(), err error) {
+	tmpl := d.FileNameTemplate
+	if tmpl == "" {
+		tmpl = DefaultFileNameTemplate
+	}
+	name, err = utils.ExpandFileNameTemplate(tmpl, FileNameFields(res))
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if strings.Contains(tmpl, "{id}") {
+		d.namesOnce.Do(func() { d.names = throttle.NewKeyedLimiter(1) })
+		slot, _ := d.names.Reserve(name, 0)
+		if unlock, err = slot.Acquire(d.context()); err != nil {
+			return "", "", nil, err
+		}
+		fpath = filepath.Join(d.OutputDir, filepath.FromSlash(name))
+		if err = createEmpty(fpath, os.O_TRUNC); err != nil {
+			unlock()
+			return "", "", nil, err
+		}
+		return name, fpath, unlock, nil
+	}
+
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	remote := d.Storage != nil && !storage.IsLocal(d.Storage)
+
+	for i := 1; i <= maxNameCollisions; i++ {
+		candidate := name
+		if i > 1 {
+			candidate = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		}
+		if remote {
+			if _, err := d.Storage.Stat(candidate); err == nil {
+				continue
+			}
+		}
+
+		fpath = filepath.Join(d.OutputDir, filepath.FromSlash(candidate))
+		err = createEmpty(fpath, os.O_EXCL)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", "", nil, err
+		}
+		return candidate, fpath, func() {}, nil
+	}
+	return "", "", nil, fmt.Errorf("no free file name for %q", name)
+}
+
+// createEmpty creates the file at fpath and its directories; flag adds os.O_EXCL or os.O_TRUNC.
+func createEmpty(fpath string, flag int) error {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_WRONLY|flag, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// release removes a reserved output file that won't be written.
+func (d *Downloader) release(fpath string) {
+	if err := os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+		slog.Error("Error removing reserved file", "error", err)
+	}
+}
+
+// StorageName converts a local path inside OutputDir into its name in Storage.
+func (d *Downloader) StorageName(localPath string) string {
+	rel, err := filepath.Rel(d.OutputDir, localPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.Base(localPath)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,92 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+)
+
+func TestReserveName(t *testing.T) {
+	video := &models.VideoResult{VideoID: "dQw4w9WgXcQ", Title: "Same: title", Extension: "mp4"}
+	other := &models.VideoResult{VideoID: "9bZkp7q19f0", Title: "Same: title", Extension: "mp4"}
+
+	tests := []struct {
+		name   string
+		tmpl   string
+		videos []*models.VideoResult
+		want   []string
+	}{
+		{
+			name:   "default template overwrites",
+			videos: []*models.VideoResult{video, video, other},
+			want:   []string{"dQw4w9WgXcQ.mp4", "dQw4w9WgXcQ.mp4", "9bZkp7q19f0.mp4"},
+		},
+		{
+			name:   "title with ID overwrites",
+			tmpl:   "{title} [{id}].{ext}",
+			videos: []*models.VideoResult{video, video},
+			want:   []string{"Same_ title [dQw4w9WgXcQ].mp4", "Same_ title [dQw4w9WgXcQ].mp4"},
+		},
+		{
+			name:   "title alone gets suffixes",
+			tmpl:   "{channel}/{title}.{ext}",
+			videos: []*models.VideoResult{video, other, video},
+			want:   []string{"unknown channel/Same_ title.mp4", "unknown channel/Same_ title (2).mp4", "unknown channel/Same_ title (3).mp4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Downloader{OutputDir: t.TempDir(), FileNameTemplate: tt.tmpl}
+			for i, res := range tt.videos {
+				name, fpath, unlock, err := d.reserveName(res)
+				if err != nil {
+					t.Fatal(err)
+				}
+				unlock()
+				if name != tt.want[i] {
+					t.Errorf("name %d = %q, want %q", i, name, tt.want[i])
+				}
+				if fpath != filepath.Join(d.OutputDir, filepath.FromSlash(name)) {
+					t.Errorf("path %d = %q, not in OutputDir", i, fpath)
+				}
+				if _, err := os.Stat(fpath); err != nil {
+					t.Errorf("name %d not reserved: %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+// TestReserveNameWaits checks that a second download of a video waits for the first one.
+func TestReserveNameWaits(t *testing.T) {
+	d := &Downloader{OutputDir: t.TempDir()}
+	res := &models.VideoResult{VideoID: "dQw4w9WgXcQ", Extension: "mp4"}
+
+	_, _, unlock, err := d.reserveName(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserved := make(chan struct{})
+	go func() {
+		_, _, unlock2, err := d.reserveName(res)
+		if err == nil {
+			unlock2()
+		}
+		close(reserved)
+	}()
+
+	select {
+	case <-reserved:
+		t.Fatal("second download got the name while the first still writes it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-reserved:
+	case <-time.After(time.Second):
+		t.Fatal("second download still waits after the first finished")
+	}
+}
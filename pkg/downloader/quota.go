@@ -0,0 +1,137 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/imbecility/yt-gateway/pkg/storage"
+)
+
+// minFreeSpace is kept untouched on the scratch disk so the OS and ffmpeg still have room.
+const minFreeSpace = 200 * 1024 * 1024
+
+var (
+	ErrFileTooLarge   = errors.New("file exceeds size limit")
+	ErrQuotaExceeded  = errors.New("storage quota exceeded")
+	ErrNotEnoughSpace = errors.New("not enough free disk space")
+)
+
+// claim collects the bytes reserved by the streams of one download until it ends.
+type claim struct {
+	bytes int64
+}
+
+// reserve checks that a stream of the given size (-1 if unknown) fits the per-file cap,
+// the free disk space and the storage quota, evicting old files if an Evict hook is set.
+// The space stays reserved for c until unreserve, so parallel downloads can't all take the same room.
+func (d *Downloader) reserve(size int64, c *claim) error {
+	if d.MaxFileSize > 0 && size > d.MaxFileSize {
+		return fmt.Errorf("%w: %d MB > %d MB", ErrFileTooLarge, size/1024/1024, d.MaxFileSize/1024/1024)
+	}
+
+	need := size
+	if need < 0 {
+		need = 0
+	}
+
+	d.spaceMu.Lock()
+	defer d.spaceMu.Unlock()
+	if err := d.checkSpace(need); err != nil {
+		return err
+	}
+	d.inFlight += need
+	c.bytes += need
+	return nil
+}
+
+// unreserve gives back the space of a download that ended; its file, if any, is counted from then on.
+func (d *Downloader) unreserve(c *claim) {
+	d.spaceMu.Lock()
+	defer d.spaceMu.Unlock()
+	d.inFlight -= c.bytes
+	c.bytes = 0
+}
+
+// checkSpace checks need bytes on top of the ones in flight. Call with spaceMu held.
+func (d *Downloader) checkSpace(need int64) error {
+	if free, err := freeSpace(d.OutputDir); err == nil {
+		free -= d.inFlight
+		if lack := need + minFreeSpace - free; lack > 0 {
+			if d.Storage != nil && storage.IsLocal(d.Storage) && d.Evict != nil {
+				free += d.Evict(lack)
+			}
+			if need+minFreeSpace > free {
+				return fmt.Errorf("%w: %d MB available", ErrNotEnoughSpace, free/1024/1024)
+			}
+		}
+	} else {
+		slog.Debug("Free space check skipped", "err", err)
+	}
+
+	if d.Quota <= 0 || d.Storage == nil {
+		return nil
+	}
+
+	used, err := d.storageUsage()
+	if err != nil {
+		slog.Warn("Failed to compute storage usage", "err", err)
+		return nil
+	}
+	used += d.inFlight
+	fits := func(used int64) bool {
+		if need == 0 {
+			return used < d.Quota
+		}
+		return used+need <= d.Quota
+	}
+	if !fits(used) && d.Evict != nil {
+		used -= d.Evict(max(used+need-d.Quota, 1))
+	}
+	if !fits(used) {
+		return fmt.Errorf("%w: %d MB used of %d MB", ErrQuotaExceeded, used/1024/1024, d.Quota/1024/1024)
+	}
+	return nil
+}
+
+// storageUsage sums the sizes of finished files in storage.
+func (d *Downloader) storageUsage() (int64, error) {
+	files, err := d.Storage.List()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, f := range files {
+		if storage.IsTemp(f.Name) {
+			continue
+		}
+		total += f.Size
+	}
+	return total, nil
+}
+
+// newBudget returns the shared byte allowance for one output file, or nil when unlimited.
+func (d *Downloader) newBudget() *atomic.Int64 {
+	if d.MaxFileSize <= 0 {
+		return nil
+	}
+	b := &atomic.Int64{}
+	b.Store(d.MaxFileSize)
+	return b
+}
+
+// capReader aborts the stream once the budget shared by all streams of one file runs out.
+type capReader struct {
+	io.Reader
+	budget *atomic.Int64
+}
+
+func (c *capReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	if n > 0 && c.budget.Add(-int64(n)) < 0 {
+		return n, ErrFileTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,48 @@
+package downloader
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/storage"
+)
+
+// tempDirPrefixes start the names of the scratch directories of splitting and subtitle burning.
+var tempDirPrefixes = []string{"split_temp", "subs_temp"}
+
+// SweepTemp deletes the work files and directories that interrupted runs left in OutputDir
+// and returns how many it removed. Call it only while nothing is being downloaded.
+func (d *Downloader) SweepTemp() int {
+	removed := 0
+	_ = filepath.WalkDir(d.OutputDir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil || path == d.OutputDir {
+			return nil
+		}
+		name := e.Name()
+		if e.IsDir() {
+			for _, prefix := range tempDirPrefixes {
+				if strings.HasPrefix(name, prefix) {
+					if rerr := os.RemoveAll(path); rerr != nil {
+						slog.Warn("Failed to remove leftover directory", "path", path, "err", rerr)
+					} else {
+						removed++
+					}
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if storage.IsTemp(name) {
+			if rerr := os.Remove(path); rerr != nil {
+				slog.Warn("Failed to remove leftover file", "path", path, "err", rerr)
+			} else {
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed
+}
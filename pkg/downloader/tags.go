@@ -0,0 +1,81 @@
+package downloader
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/ffmpeg"
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/providers"
+)
+
+// audioExtensions are outputs without a picture, they get the thumbnail as cover art.
+var audioExtensions = map[string]bool{"m4a": true, "mp3": true, "aac": true, "opus": true, "ogg": true}
+
+// tags builds the container tags for res when EmbedMetadata is on (nil otherwise).
+// The returned cleanup removes the temporary cover art.
+func (d *Downloader) tags(res *models.VideoResult) (*ffmpeg.Tags, func()) {
+	if !d.EmbedMetadata {
+		return nil, func() {}
+	}
+
+	tags := &ffmpeg.Tags{
+		Title:      res.Title,
+		Channel:    res.Channel,
+		SourceURL:  "https://www.youtube.com/watch?v=" + res.VideoID,
+		VideoID:    res.VideoID,
+		UploadDate: res.UploadDate,
+	}
+
+	if !audioExtensions[strings.ToLower(res.Extension)] {
+		return tags, func() {}
+	}
+	cover := filepath.Join(d.OutputDir, res.VideoID+"_cover_tmp.jpg")
+	if err := providers.FetchThumbnail(d.Client, res.VideoID, cover); err != nil {
+		slog.Warn("Failed to fetch cover art", "id", res.VideoID, "err", err)
+		return tags, func() {}
+	}
+	tags.CoverArt = cover
+	return tags, func() {
+		if err := os.Remove(cover); err != nil {
+			slog.Error("Error removing cover art", "error", err)
+		}
+	}
+}
+
+// lookupDetails fills the channel and upload date of res if neither the provider
+// nor an earlier metadata lookup supplied them. With res.Metadata set (see
+// gateway.Service.ApplyMetadata) nothing is fetched.
+func (d *Downloader) lookupDetails(res *models.VideoResult) {
+	if res.Channel != "" || res.UploadDate != "" {
+		return
+	}
+	if res.Metadata == nil {
+		md, err := providers.GetVideoMetadata(d.Client, res.VideoID)
+		if err != nil {
+			slog.Warn("Failed to fetch video details", "id", res.VideoID, "err", err)
+			return
+		}
+		res.Metadata = md
+	}
+	res.Channel, res.UploadDate = res.Metadata.Channel, res.Metadata.UploadDate
+}
+
+// tagFile rewrites a directly downloaded file with the tags. Failures are logged and
+// the file is kept untagged, as the download itself is fine.
+func (d *Downloader) tagFile(path string, tags *ffmpeg.Tags) {
+	ext := filepath.Ext(path)
+	tmp := strings.TrimSuffix(path, ext) + "_tag_tmp" + ext
+
+	if err := d.Muxer().Tag(path, tmp, *tags); err != nil {
+		slog.Warn("Failed to tag file, keeping it untagged", "path", path, "err", err)
+		_ = os.Remove(tmp)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		slog.Warn("Failed to replace file with tagged copy", "path", path, "err", err)
+		_ = os.Remove(tmp)
+	}
+}
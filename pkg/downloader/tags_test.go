@@ -0,0 +1,36 @@
+package downloader
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+)
+
+// countingClient fails every request and counts them.
+type countingClient struct{ requests int }
+
+func (c *countingClient) Do(*http.Request) (*http.Response, error) {
+	c.requests++
+	return nil, errors.New("offline")
+}
+
+func TestLookupDetails(t *testing.T) {
+	client := &countingClient{}
+	d := &Downloader{Client: client}
+
+	res := &models.VideoResult{VideoID: "dQw4w9WgXcQ", Metadata: &models.VideoMetadata{Channel: "Rick Astley", UploadDate: "2009-10-25"}}
+	d.lookupDetails(res)
+	if client.requests != 0 {
+		t.Errorf("%d requests with the metadata already fetched", client.requests)
+	}
+	if res.Channel != "Rick Astley" || res.UploadDate != "2009-10-25" {
+		t.Errorf("details not taken from the metadata: %q %q", res.Channel, res.UploadDate)
+	}
+
+	d.lookupDetails(&models.VideoResult{VideoID: "dQw4w9WgXcQ"})
+	if client.requests == 0 {
+		t.Error("no lookup without metadata")
+	}
+}
@@ -0,0 +1,106 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AnimationOptions configures an animated image export.
+type AnimationOptions struct {
+	// Format is "gif" (default) or "webp".
+	Format string
+	// Width in pixels, height keeps the aspect ratio (defaults to 480).
+	Width int
+	// FPS of the animation (defaults to 12).
+	FPS float64
+	// Start and End select the time range in seconds; End 0 means Start + 10 seconds.
+	Start float64
+	End   float64
+}
+
+// Normalize fills defaults and validates the options.
+func (o *AnimationOptions) Normalize() error {
+	o.Format = strings.ToLower(strings.TrimPrefix(o.Format, "."))
+	if o.Format == "" {
+		o.Format = "gif"
+	}
+	if o.Format != "gif" && o.Format != "webp" {
+		return fmt.Errorf("unknown animation format %q (want gif or webp)", o.Format)
+	}
+	if o.Width <= 0 {
+		o.Width = 480
+	}
+	if o.FPS <= 0 {
+		o.FPS = 12
+	}
+	if o.End <= 0 {
+		o.End = o.Start + 10
+	}
+	if o.Start < 0 || o.End <= o.Start {
+		return fmt.Errorf("invalid animation range %.3f-%.3f", o.Start, o.End)
+	}
+	return nil
+}
+
+// SupportsAnimation returns an ErrUnsupported error unless the binary can export
+// animations in format ("gif" or "webp"). The bundled nano build can't.
+func (m *Muxer) SupportsAnimation(format string) error {
+	encoders, filters := []string{"gif"}, []string{"fps", "scale", "split", "palettegen", "paletteuse"}
+	if format == "webp" {
+		encoders, filters = []string{"libwebp"}, []string{"fps", "scale"}
+	}
+	if err := m.Require(encoders, filters); err != nil {
+		return fmt.Errorf("%s export: %w", format, err)
+	}
+	return nil
+}
+
+// Animate renders the selected range of input as an animated GIF (two-pass palette for
+// clean colors) or an animated WebP. Needs an ffmpeg build with the h264 decoder and
+// the gif/libwebp encoders; missing encoders/filters are reported as ErrUnsupported.
+func (m *Muxer) Animate(input, output string, opts AnimationOptions) error {
+	if err := opts.Normalize(); err != nil {
+		return err
+	}
+	if err := m.SupportsAnimation(opts.Format); err != nil {
+		return err
+	}
+
+	scale := fmt.Sprintf("fps=%g,scale=%d:-2:flags=lanczos", opts.FPS, opts.Width)
+	args := []string{
+		"-hide_banner",
+		"-ss", fmt.Sprintf("%.3f", opts.Start),
+		"-t", fmt.Sprintf("%.3f", opts.End-opts.Start),
+		"-i", input,
+		"-an", "-sn", "-dn",
+		"-map_metadata", "-1",
+	}
+	switch opts.Format {
+	case "gif":
+		args = append(args,
+			"-filter_complex", scale+",split[a][b];[a]palettegen=stats_mode=diff[p];[b][p]paletteuse=dither=bayer:bayer_scale=5",
+			"-loop", "0",
+		)
+	case "webp":
+		args = append(args,
+			"-vf", scale,
+			"-c:v", "libwebp",
+			"-lossless", "0",
+			"-q:v", "70",
+			"-loop", "0",
+		)
+	}
+	args = append(args, "-f", opts.Format, "-y", output)
+
+	out, err := m.command(args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg error: %s, ffmpeg output: %s", err, string(out))
+	}
+	st, sterr := os.Stat(output)
+	if sterr != nil || st.Size() == 0 {
+		return errors.New("ffmpeg produced empty file or no file")
+	}
+	return nil
+}
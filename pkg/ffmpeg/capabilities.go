@@ -0,0 +1,77 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// capabilities caches what each ffmpeg binary was built with, keyed by binary path.
+var capabilities sync.Map
+
+type capabilitySet struct {
+	encoders map[string]bool
+	filters  map[string]bool
+}
+
+// Require returns an error wrapping ErrUnsupported if the binary lacks any of the
+// encoders or filters (the bundled nano build only remuxes).
+func (m *Muxer) Require(encoders, filters []string) error {
+	caps, err := m.capabilities()
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, e := range encoders {
+		if !caps.encoders[e] {
+			missing = append(missing, "encoder "+e)
+		}
+	}
+	for _, f := range filters {
+		if !caps.filters[f] {
+			missing = append(missing, "filter "+f)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing %s (a full ffmpeg build is needed)", ErrUnsupported, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (m *Muxer) capabilities() (*capabilitySet, error) {
+	if c, ok := capabilities.Load(m.BinaryPath); ok {
+		return c.(*capabilitySet), nil
+	}
+
+	caps := &capabilitySet{}
+	var err error
+	if caps.encoders, err = m.listNames("-encoders"); err != nil {
+		return nil, err
+	}
+	if caps.filters, err = m.listNames("-filters"); err != nil {
+		return nil, err
+	}
+	capabilities.Store(m.BinaryPath, caps)
+	return caps, nil
+}
+
+// listNames parses the second column of "ffmpeg -encoders"/"-filters" after the "------" line.
+func (m *Muxer) listNames(flag string) (map[string]bool, error) {
+	out, err := m.command("-hide_banner", flag).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg %s failed: %w", flag, err)
+	}
+	names := make(map[string]bool)
+	started := false
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if !started {
+			started = len(fields) == 1 && strings.HasPrefix(fields[0], "---")
+			continue
+		}
+		if len(fields) >= 2 {
+			names[fields[1]] = true
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,105 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+)
+
+// ClipOptions selects a time range of a file.
+type ClipOptions struct {
+	// Start and End are in seconds; End 0 means the end of the file.
+	Start float64
+	End   float64
+	// Accurate re-encodes the video so the clip starts exactly at Start.
+	// Without it the streams are copied and the clip starts at the keyframe at or before Start.
+	Accurate bool
+}
+
+// IsZero reports whether no range is selected.
+func (o ClipOptions) IsZero() bool {
+	return o.Start <= 0 && o.End <= 0
+}
+
+// Clip writes the selected range of input to output and returns where the clip
+// actually starts and ends in the source.
+func (m *Muxer) Clip(input, output string, opts ClipOptions) (float64, float64, error) {
+	media, packets, err := m.probeCuts(input)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to probe file: %w", err)
+	}
+
+	start, end := opts.Start, opts.End
+	if end <= 0 || (media.DurationSec > 0 && end > media.DurationSec) {
+		end = media.DurationSec
+	}
+	if start < 0 || end <= 0 || start >= end {
+		return 0, 0, fmt.Errorf("invalid clip range %.3f-%.3f (duration %.3f)", opts.Start, opts.End, media.DurationSec)
+	}
+
+	if opts.Accurate {
+		if err := m.encodeSegment(input, output, start, end); err != nil {
+			return 0, 0, err
+		}
+		return start, end, nil
+	}
+
+	// stream copy can only start at a keyframe: take the one at or before start
+	if i := sort.SearchFloat64s(media.Keyframes, start+cutEpsilon); i > 0 {
+		start = media.Keyframes[i-1]
+	} else if len(media.Keyframes) > 0 {
+		start = 0
+	}
+
+	frames := 0
+	if len(media.Keyframes) > 0 {
+		frames = newCutPlan(packets, media.Keyframes).rangeOf(start, end).VideoFrames
+	} else {
+		slog.Debug("Packets unknown, clip end follows ffmpeg")
+	}
+
+	if err := m.cutSegment(input, output, start, end, frames); err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// encodeSegment re-encodes [start, end) of input, frame-accurate at both ends.
+// Needs an ffmpeg build with libx264 and aac encoders.
+func (m *Muxer) encodeSegment(input, output string, start, end float64) error {
+	if err := m.Require([]string{"libx264", "aac"}, nil); err != nil {
+		return err
+	}
+	cmd := m.command(
+		"-hide_banner",
+		"-ss", fmt.Sprintf("%.3f", start),
+		"-i", input,
+		"-t", fmt.Sprintf("%.3f", end-start),
+		"-map", "0:v:0?",
+		"-map", "0:a:0?",
+		"-map", "0:s?",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "18",
+		"-c:a", "aac",
+		"-b:a", "192k",
+		"-c:s", "copy",
+		"-dn",
+		"-map_metadata", "0",
+		"-map_chapters", "-1",
+		"-movflags", "faststart",
+		"-y",
+		output,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg error: %s, ffmpeg output: %s", err, string(out))
+	}
+	st, sterr := os.Stat(output)
+	if sterr != nil || st.Size() == 0 {
+		return errors.New("ffmpeg produced empty file or no file")
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package ffmpeg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Packet is one compressed frame of a stream, as stored in the container.
+type Packet struct {
+	Stream int
+	Video  bool
+	// Time is the presentation time in seconds.
+	Time float64
+	Size int64
+	Key  bool
+}
+
+var errNotMP4 = errors.New("not an mp4 file")
+
+// readMP4Packets lists the packets of all audio/video tracks straight from the MP4 sample tables,
+// so keyframes and packet sizes are known without ffprobe (the bundled ffmpeg has none).
+func readMP4Packets(path string) ([]Packet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	moov, err := findTopBox(f, "moov")
+	if err != nil {
+		return nil, err
+	}
+
+	var packets []Packet
+	stream := 0
+	for _, trak := range childBoxes(moov, "trak") {
+		t, err := parseTrak(trak, fi.Size())
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			packets = append(packets, t.packets(stream)...)
+		}
+		stream++
+	}
+	if len(packets) == 0 {
+		return nil, fmt.Errorf("%w: no samples in moov (fragmented?)", errNotMP4)
+	}
+
+	sortPackets(packets)
+	return packets, nil
+}
+
+func sortPackets(packets []Packet) {
+	sort.SliceStable(packets, func(i, j int) bool { return packets[i].Time < packets[j].Time })
+}
+
+// findTopBox scans top-level boxes and returns the payload of the first one of the given type.
+func findTopBox(r io.ReadSeeker, want string) ([]byte, error) {
+	var off int64
+	hdr := make([]byte, 16)
+	for {
+		if _, err := r.Seek(off, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, hdr[:8]); err != nil {
+			if off == 0 {
+				return nil, errNotMP4
+			}
+			return nil, fmt.Errorf("%w: %s box not found", errNotMP4, want)
+		}
+
+		size := int64(binary.BigEndian.Uint32(hdr[:4]))
+		typ := string(hdr[4:8])
+		hdrLen := int64(8)
+		switch size {
+		case 1:
+			if _, err := io.ReadFull(r, hdr[8:16]); err != nil {
+				return nil, errNotMP4
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			hdrLen = 16
+		case 0:
+			end, err := r.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+			size = end - off
+		}
+		if size < hdrLen || (off == 0 && typ != "ftyp" && typ != "moov" && typ != "free" && typ != "mdat" && typ != "wide") {
+			return nil, errNotMP4
+		}
+
+		if typ == want {
+			if size > 256<<20 {
+				return nil, fmt.Errorf("%s box too large: %d bytes", want, size)
+			}
+			buf := make([]byte, size-hdrLen)
+			if _, err := r.Seek(off+hdrLen, io.SeekStart); err != nil {
+				return nil, err
+			}
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return nil, err
+			}
+			return buf, nil
+		}
+		off += size
+	}
+}
+
+// childBoxes returns the payloads of the direct children of the given type.
+func childBoxes(data []byte, want string) [][]byte {
+	var out [][]byte
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		typ := string(data[4:8])
+		hdrLen := uint64(8)
+		if size == 1 {
+			if len(data) < 16 {
+				break
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			hdrLen = 16
+		} else if size == 0 {
+			size = uint64(len(data))
+		}
+		if size < hdrLen || size > uint64(len(data)) {
+			break
+		}
+		if typ == want {
+			out = append(out, data[hdrLen:size])
+		}
+		data = data[size:]
+	}
+	return out
+}
+
+func childBox(data []byte, path ...string) []byte {
+	for _, name := range path {
+		boxes := childBoxes(data, name)
+		if len(boxes) == 0 {
+			return nil
+		}
+		data = boxes[0]
+	}
+	return data
+}
+
+type mp4Track struct {
+	video      bool
+	timescale  uint32
+	shift      int64 // edit list media_time, subtracted from pts
+	deltas     []uint32
+	ctsOffsets []int32
+	sizes      []uint32
+	keys       map[uint32]bool // 1-based sample numbers; nil = every sample is a keyframe
+}
+
+// maxMP4Samples caps the samples of a track: over 70 hours of 60 fps video.
+const maxMP4Samples = 1 << 24
+
+// parseTrak returns nil for tracks that are neither audio nor video. fileSize bounds
+// the media data the sample tables can describe.
+func parseTrak(trak []byte, fileSize int64) (*mp4Track, error) {
+	mdia := childBox(trak, "mdia")
+	hdlr := childBox(mdia, "hdlr")
+	if len(hdlr) < 12 {
+		return nil, fmt.Errorf("%w: bad hdlr box", errNotMP4)
+	}
+	handler := string(hdlr[8:12])
+	if handler != "vide" && handler != "soun" {
+		return nil, nil
+	}
+
+	t := &mp4Track{video: handler == "vide"}
+
+	mdhd := childBox(mdia, "mdhd")
+	switch {
+	case len(mdhd) >= 24 && mdhd[0] == 1:
+		t.timescale = binary.BigEndian.Uint32(mdhd[20:24])
+	case len(mdhd) >= 16:
+		t.timescale = binary.BigEndian.Uint32(mdhd[12:16])
+	}
+	if t.timescale == 0 {
+		return nil, fmt.Errorf("%w: bad mdhd box", errNotMP4)
+	}
+
+	if elst := childBox(trak, "edts", "elst"); len(elst) >= 8 {
+		version := elst[0]
+		entries := binary.BigEndian.Uint32(elst[4:8])
+		p := elst[8:]
+		for i := uint32(0); i < entries; i++ {
+			var mediaTime int64
+			if version == 1 {
+				if len(p) < 20 {
+					break
+				}
+				mediaTime = int64(binary.BigEndian.Uint64(p[8:16]))
+				p = p[20:]
+			} else {
+				if len(p) < 12 {
+					break
+				}
+				mediaTime = int64(int32(binary.BigEndian.Uint32(p[4:8])))
+				p = p[12:]
+			}
+			if mediaTime >= 0 { // -1 marks an empty edit
+				t.shift = mediaTime
+				break
+			}
+		}
+	}
+
+	stbl := childBox(mdia, "minf", "stbl")
+	if stbl == nil {
+		return nil, fmt.Errorf("%w: no stbl box", errNotMP4)
+	}
+
+	// the sample count bounds the other tables, so broken or hostile counts can't
+	// make them allocate more than the file could hold
+	if stsz := childBox(stbl, "stsz"); len(stsz) >= 12 {
+		fixed := binary.BigEndian.Uint32(stsz[4:8])
+		n := binary.BigEndian.Uint32(stsz[8:12])
+		p := stsz[12:]
+		switch {
+		case n > maxMP4Samples:
+			return nil, fmt.Errorf("%w: %d samples in stsz box", errNotMP4, n)
+		case fixed == 0 && uint64(n) > uint64(len(p)/4):
+			return nil, fmt.Errorf("%w: stsz box shorter than its %d samples", errNotMP4, n)
+		case fixed != 0 && uint64(n)*uint64(fixed) > uint64(fileSize):
+			return nil, fmt.Errorf("%w: stsz box describes more data than the file has", errNotMP4)
+		}
+		t.sizes = make([]uint32, n)
+		for i := range t.sizes {
+			if fixed != 0 {
+				t.sizes[i] = fixed
+				continue
+			}
+			t.sizes[i] = binary.BigEndian.Uint32(p[:4])
+			p = p[4:]
+		}
+	}
+	samples := uint32(len(t.sizes))
+
+	if stts := childBox(stbl, "stts"); len(stts) >= 8 {
+		n := binary.BigEndian.Uint32(stts[4:8])
+		p := stts[8:]
+		t.deltas = make([]uint32, 0, samples)
+		for i := uint32(0); i < n && len(p) >= 8; i++ {
+			count := min(binary.BigEndian.Uint32(p[:4]), samples-uint32(len(t.deltas)))
+			delta := binary.BigEndian.Uint32(p[4:8])
+			for j := uint32(0); j < count; j++ {
+				t.deltas = append(t.deltas, delta)
+			}
+			p = p[8:]
+		}
+	}
+
+	if ctts := childBox(stbl, "ctts"); len(ctts) >= 8 {
+		n := binary.BigEndian.Uint32(ctts[4:8])
+		p := ctts[8:]
+		t.ctsOffsets = make([]int32, 0, samples)
+		for i := uint32(0); i < n && len(p) >= 8; i++ {
+			count := min(binary.BigEndian.Uint32(p[:4]), samples-uint32(len(t.ctsOffsets)))
+			off := int32(binary.BigEndian.Uint32(p[4:8]))
+			for j := uint32(0); j < count; j++ {
+				t.ctsOffsets = append(t.ctsOffsets, off)
+			}
+			p = p[8:]
+		}
+	}
+
+	if stss := childBox(stbl, "stss"); len(stss) >= 8 {
+		n := binary.BigEndian.Uint32(stss[4:8])
+		p := stss[8:]
+		t.keys = make(map[uint32]bool, min(n, uint32(len(p)/4)))
+		for i := uint32(0); i < n && len(p) >= 4; i++ {
+			t.keys[binary.BigEndian.Uint32(p[:4])] = true
+			p = p[4:]
+		}
+	}
+
+	return t, nil
+}
+
+func (t *mp4Track) packets(stream int) []Packet {
+	n := min(len(t.deltas), len(t.sizes))
+	out := make([]Packet, 0, n)
+
+	var dts int64
+	for i := 0; i < n; i++ {
+		pts := dts - t.shift
+		if i < len(t.ctsOffsets) {
+			pts += int64(t.ctsOffsets[i])
+		}
+		out = append(out, Packet{
+			Stream: stream,
+			Video:  t.video,
+			Time:   float64(pts) / float64(t.timescale),
+			Size:   int64(t.sizes[i]),
+			Key:    t.keys == nil || t.keys[uint32(i+1)],
+		})
+		dts += int64(t.deltas[i])
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package ffmpeg
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func box(typ string, payload ...[]byte) []byte {
+	var body []byte
+	for _, p := range payload {
+		body = append(body, p...)
+	}
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+// fullBox is the version/flags word followed by 32-bit fields.
+func fullBox(typ string, fields ...uint32) []byte {
+	payload := make([]byte, 4)
+	for _, f := range fields {
+		payload = binary.BigEndian.AppendUint32(payload, f)
+	}
+	return box(typ, payload)
+}
+
+// testTrak builds the payload of a video trak box, 1000 timescale units per second.
+func testTrak(stts, stsz []byte) []byte {
+	hdlr := box("hdlr", make([]byte, 8), []byte("vide"), make([]byte, 12))
+	mdhd := fullBox("mdhd", 0, 0, 1000, 0)
+	return box("mdia", hdlr, mdhd, box("minf", box("stbl", stts, stsz)))
+}
+
+func TestParseTrak(t *testing.T) {
+	tests := []struct {
+		name     string
+		stts     []byte
+		stsz     []byte
+		fileSize int64
+		packets  int
+		wantErr  bool
+	}{
+		{
+			name:     "fixed sample size",
+			stts:     fullBox("stts", 1, 3, 500),
+			stsz:     fullBox("stsz", 100, 3),
+			fileSize: 1 << 20,
+			packets:  3,
+		},
+		{
+			name:     "sample sizes listed",
+			stts:     fullBox("stts", 2, 1, 500, 1, 250),
+			stsz:     fullBox("stsz", 0, 2, 10, 20),
+			fileSize: 1 << 20,
+			packets:  2,
+		},
+		{
+			name:     "stts count beyond the samples",
+			stts:     fullBox("stts", 1, 0xFFFFFFFF, 500),
+			stsz:     fullBox("stsz", 100, 3),
+			fileSize: 1 << 20,
+			packets:  3,
+		},
+		{
+			name:     "huge sample count",
+			stts:     fullBox("stts", 1, 3, 500),
+			stsz:     fullBox("stsz", 100, 0xFFFFFFFF),
+			fileSize: 1 << 20,
+			wantErr:  true,
+		},
+		{
+			name:     "fixed sizes larger than the file",
+			stts:     fullBox("stts", 1, 3, 500),
+			stsz:     fullBox("stsz", 1<<20, 1<<16),
+			fileSize: 1 << 20,
+			wantErr:  true,
+		},
+		{
+			name:     "listed sizes missing",
+			stts:     fullBox("stts", 1, 3, 500),
+			stsz:     fullBox("stsz", 0, 1000, 10, 20),
+			fileSize: 1 << 20,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trak, err := parseTrak(testTrak(tt.stts, tt.stsz), tt.fileSize)
+			if tt.wantErr {
+				if !errors.Is(err, errNotMP4) {
+					t.Fatalf("err = %v, want errNotMP4", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(trak.packets(0)); got != tt.packets {
+				t.Errorf("got %d packets, want %d", got, tt.packets)
+			}
+		})
+	}
+}
@@ -1,34 +1,35 @@
 package ffmpeg
 
 import (
-	"fmt"
+	"context"
 	"os/exec"
 )
 
 type Muxer struct {
 	BinaryPath string
+	// Context kills the running ffmpeg processes when cancelled (nil = never).
+	Context context.Context
+	// KeepTags keeps the container tags of the input in clips and split parts, which are stripped otherwise.
+	KeepTags bool
+	// KeepSubtitles keeps embedded subtitle tracks in clips and split parts, which are dropped otherwise.
+	KeepSubtitles bool
 }
 
-func (m *Muxer) Mux(videoPath, audioPath, outPath string) error {
-	cmd := exec.Command(
-		m.BinaryPath,
-		"-hide_banner",
-		"-i", videoPath,
-		"-i", audioPath,
-		"-c", "copy",
-		"-map", "0:v:0",
-		"-map", "1:a:0",
-		"-sn", "-dn",
-		"-map_metadata", "-1",
-		"-map_chapters", "-1",
-		"-movflags", "faststart",
-		"-y",
-		outPath,
-	)
+// command prepares an ffmpeg run that is killed when m.Context is cancelled.
+func (m *Muxer) command(args ...string) *exec.Cmd {
+	return m.commandFor(m.BinaryPath, args...)
+}
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("ffmpeg error: %s, output: %s", err, string(output))
+// commandFor is command for another binary of the build, such as ffprobe.
+func (m *Muxer) commandFor(binary string, args ...string) *exec.Cmd {
+	ctx := m.Context
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	return nil
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// Mux combines the video and audio streams, dropping all metadata of the sources.
+func (m *Muxer) Mux(videoPath, audioPath, outPath string) error {
+	return m.MuxWithTags(videoPath, audioPath, outPath, nil)
 }
@@ -0,0 +1,463 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+)
+
+// MediaInfo is the structured description of a media file returned by Probe.
+type MediaInfo struct {
+	Format      string
+	DurationSec float64
+	BitrateKbps int
+	SizeBytes   int64
+	Streams     []StreamInfo
+	// Keyframes are presentation times (seconds) of the video keyframes, only filled by
+	// ProbeKeyframes: listing them reads the whole packet index.
+	Keyframes []float64
+	Chapters  []models.Chapter
+}
+
+type StreamInfo struct {
+	Index       int
+	Type        string // "video", "audio", "subtitle", "data", "attachment"
+	Codec       string
+	Language    string
+	BitrateKbps int
+	Width       int
+	Height      int
+	FPS         float64
+	SampleRate  int
+	Channels    string
+}
+
+// Video returns the first video stream or nil.
+func (mi *MediaInfo) Video() *StreamInfo {
+	return mi.stream("video")
+}
+
+// Audio returns the first audio stream or nil.
+func (mi *MediaInfo) Audio() *StreamInfo {
+	return mi.stream("audio")
+}
+
+func (mi *MediaInfo) stream(typ string) *StreamInfo {
+	for i := range mi.Streams {
+		if mi.Streams[i].Type == typ {
+			return &mi.Streams[i]
+		}
+	}
+	return nil
+}
+
+// Summary condenses the info into the form carried by models.VideoResult.
+func (mi *MediaInfo) Summary() *models.MediaInfo {
+	sum := &models.MediaInfo{
+		DurationSec: mi.DurationSec,
+		SizeBytes:   mi.SizeBytes,
+		BitrateKbps: mi.BitrateKbps,
+	}
+	if v := mi.Video(); v != nil {
+		sum.VideoCodec = v.Codec
+		sum.Width = v.Width
+		sum.Height = v.Height
+	}
+	if a := mi.Audio(); a != nil {
+		sum.AudioCodec = a.Codec
+	}
+	return sum
+}
+
+// Probe describes the file at path from its header, without reading the packets. It uses
+// ffprobe's JSON output when an ffprobe binary sits next to ffmpeg (or in PATH), otherwise
+// it parses `ffmpeg -i`.
+func (m *Muxer) Probe(path string) (*MediaInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var info *MediaInfo
+	if probe := m.ffprobePath(); probe != "" {
+		info, err = m.runFFprobe(probe, path)
+		if err != nil {
+			slog.Debug("ffprobe failed, falling back to ffmpeg output", "err", err)
+		}
+	}
+	if info == nil {
+		info, err = m.probeWithFFmpeg(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	info.SizeBytes = stat.Size()
+	return info, nil
+}
+
+// ProbeKeyframes is Probe plus the keyframe positions (Keyframes), read from the packets
+// with ffprobe or from the MP4 sample tables. It also fills the duration if the header has
+// none. Without a packet listing Keyframes stay empty.
+func (m *Muxer) ProbeKeyframes(path string) (*MediaInfo, error) {
+	info, _, err := m.probeCuts(path)
+	return info, err
+}
+
+// probeCuts is Probe plus the packet listing that cuts are planned from: it fills Keyframes,
+// and the duration if the header has none. packets is nil if they can't be listed.
+func (m *Muxer) probeCuts(path string) (*MediaInfo, []Packet, error) {
+	info, err := m.Probe(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	packets, perr := m.Packets(path)
+	if perr != nil {
+		slog.Debug("Keyframes unavailable", "path", path, "err", perr)
+		return info, nil, nil
+	}
+	for _, p := range packets {
+		if p.Video && p.Key {
+			info.Keyframes = append(info.Keyframes, p.Time)
+		}
+	}
+	if info.DurationSec <= 0 && len(packets) > 0 {
+		info.DurationSec = packets[len(packets)-1].Time
+	}
+	return info, packets, nil
+}
+
+// Packets lists the packets of all audio/video streams sorted by time.
+func (m *Muxer) Packets(path string) ([]Packet, error) {
+	if probe := m.ffprobePath(); probe != "" {
+		packets, err := m.runFFprobePackets(probe, path)
+		if err == nil {
+			return packets, nil
+		}
+		slog.Debug("ffprobe packet listing failed", "err", err)
+	}
+	return readMP4Packets(path)
+}
+
+// ffprobePath finds ffprobe next to the ffmpeg binary or in PATH; "" if there is none.
+func (m *Muxer) ffprobePath() string {
+	dir, base := filepath.Split(m.BinaryPath)
+	if strings.Contains(base, "ffmpeg") {
+		candidate := filepath.Join(dir, strings.Replace(base, "ffmpeg", "ffprobe", 1))
+		if p, err := exec.LookPath(candidate); err == nil {
+			return p
+		}
+	}
+	if p, err := exec.LookPath("ffprobe"); err == nil {
+		return p
+	}
+	return ""
+}
+
+func (m *Muxer) runFFprobe(probePath, path string) (*MediaInfo, error) {
+	out, err := m.commandFor(probePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format", "-show_streams", "-show_chapters",
+		path,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe error: %w", err)
+	}
+	return parseFFprobeInfo(out)
+}
+
+// parseFFprobeInfo reads the JSON that ffprobe prints with -show_format -show_streams -show_chapters.
+func parseFFprobeInfo(out []byte) (*MediaInfo, error) {
+	var data struct {
+		Format struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+			BitRate    string `json:"bit_rate"`
+		} `json:"format"`
+		Streams []struct {
+			Index         int    `json:"index"`
+			CodecType     string `json:"codec_type"`
+			CodecName     string `json:"codec_name"`
+			Width         int    `json:"width"`
+			Height        int    `json:"height"`
+			AvgFrameRate  string `json:"avg_frame_rate"`
+			SampleRate    string `json:"sample_rate"`
+			ChannelLayout string `json:"channel_layout"`
+			BitRate       string `json:"bit_rate"`
+			Tags          struct {
+				Language string `json:"language"`
+			} `json:"tags"`
+		} `json:"streams"`
+		Chapters []struct {
+			StartTime string `json:"start_time"`
+			EndTime   string `json:"end_time"`
+			Tags      struct {
+				Title string `json:"title"`
+			} `json:"tags"`
+		} `json:"chapters"`
+	}
+	if err := json.Unmarshal(out, &data); err != nil {
+		return nil, fmt.Errorf("bad ffprobe output: %w", err)
+	}
+
+	info := &MediaInfo{Format: data.Format.FormatName}
+	info.DurationSec, _ = strconv.ParseFloat(data.Format.Duration, 64)
+	if br, err := strconv.Atoi(data.Format.BitRate); err == nil {
+		info.BitrateKbps = br / 1000
+	}
+
+	for _, s := range data.Streams {
+		st := StreamInfo{
+			Index:    s.Index,
+			Type:     s.CodecType,
+			Codec:    s.CodecName,
+			Language: s.Tags.Language,
+			Width:    s.Width,
+			Height:   s.Height,
+			FPS:      parseRatio(s.AvgFrameRate),
+			Channels: s.ChannelLayout,
+		}
+		if st.Language == "und" {
+			st.Language = ""
+		}
+		st.SampleRate, _ = strconv.Atoi(s.SampleRate)
+		if br, err := strconv.Atoi(s.BitRate); err == nil {
+			st.BitrateKbps = br / 1000
+		}
+		info.Streams = append(info.Streams, st)
+	}
+
+	for _, c := range data.Chapters {
+		ch := models.Chapter{Title: c.Tags.Title}
+		ch.StartSec, _ = strconv.ParseFloat(c.StartTime, 64)
+		ch.EndSec, _ = strconv.ParseFloat(c.EndTime, 64)
+		info.Chapters = append(info.Chapters, ch)
+	}
+	return info, nil
+}
+
+func (m *Muxer) runFFprobePackets(probePath, path string) ([]Packet, error) {
+	out, err := m.commandFor(probePath,
+		"-v", "error",
+		"-show_entries", "packet=stream_index,pts_time,size,flags:stream=index,codec_type",
+		"-of", "csv=p=0",
+		path,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe error: %w", err)
+	}
+
+	// stream lines ("index,codec_type") and packet lines ("stream_index,pts_time,size,flags") are mixed
+	videoStreams := map[int]bool{}
+	var packets []Packet
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Split(strings.TrimSpace(line), ",")
+		switch len(f) {
+		case 2:
+			idx, _ := strconv.Atoi(f[0])
+			videoStreams[idx] = f[1] == "video"
+		case 4:
+			idx, err1 := strconv.Atoi(f[0])
+			t, err2 := strconv.ParseFloat(f[1], 64)
+			size, err3 := strconv.ParseInt(f[2], 10, 64)
+			if err1 != nil || err2 != nil || err3 != nil {
+				continue // pts_time can be N/A
+			}
+			packets = append(packets, Packet{Stream: idx, Time: t, Size: size, Key: strings.HasPrefix(f[3], "K")})
+		}
+	}
+	if len(packets) == 0 {
+		return nil, errors.New("ffprobe returned no packets")
+	}
+
+	for i := range packets {
+		packets[i].Video = videoStreams[packets[i].Stream]
+	}
+	sortPackets(packets)
+	return packets, nil
+}
+
+func parseRatio(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+func (m *Muxer) probeWithFFmpeg(path string) (*MediaInfo, error) {
+	cmd := m.command("-hide_banner", "-i", path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	// without an output file ffmpeg always exits with an error, the info is in stderr
+	_ = cmd.Run()
+
+	return parseFFmpegInfo(stderr.String())
+}
+
+var (
+	reInput    = regexp.MustCompile(`^Input #0, (.+?), from `)
+	reDuration = regexp.MustCompile(`Duration: (?:(\d+):(\d{2}):(\d{2}(?:\.\d+)?)|N/A)`)
+	reBitrate  = regexp.MustCompile(`bitrate: (\d+) kb/s`)
+	reStream   = regexp.MustCompile(`^Stream #0:(\d+)(?:\[[^\]]*\])?(?:\(([^)]*)\))?: (\w+): (.*)$`)
+	reSize     = regexp.MustCompile(`^(\d+)x(\d+)`)
+	reFPS      = regexp.MustCompile(`^([\d.]+)(k?) fps$`)
+	reKbps     = regexp.MustCompile(`^(\d+) kb/s`)
+	reHz       = regexp.MustCompile(`^(\d+) Hz$`)
+	reChapter  = regexp.MustCompile(`^Chapter #0:\d+: start (-?[\d.]+), end (-?[\d.]+)`)
+	reTitle    = regexp.MustCompile(`^title\s*: (.*)$`)
+)
+
+// parseFFmpegInfo reads the input description that `ffmpeg -i` prints to stderr.
+// Only the first input is considered; lines of other inputs/outputs are ignored.
+func parseFFmpegInfo(output string) (*MediaInfo, error) {
+	info := &MediaInfo{}
+	seenInput := false
+	var lastLine string
+	var chapter *models.Chapter
+
+	for _, raw := range strings.Split(output, "\n") {
+		line := strings.TrimSpace(raw)
+		if line != "" {
+			lastLine = line
+		}
+
+		if strings.HasPrefix(line, "Input #") {
+			if seenInput {
+				break
+			}
+			seenInput = true
+			if m := reInput.FindStringSubmatch(line); m != nil {
+				info.Format = m[1]
+			}
+			continue
+		}
+		if !seenInput {
+			continue
+		}
+		if strings.HasPrefix(line, "Output #") || strings.HasPrefix(line, "Stream mapping:") {
+			break
+		}
+
+		if strings.HasPrefix(line, "Duration:") {
+			if m := reDuration.FindStringSubmatch(line); m != nil && m[1] != "" {
+				hours, _ := strconv.ParseFloat(m[1], 64)
+				mins, _ := strconv.ParseFloat(m[2], 64)
+				secs, _ := strconv.ParseFloat(m[3], 64)
+				info.DurationSec = hours*3600 + mins*60 + secs
+			}
+			if m := reBitrate.FindStringSubmatch(line); m != nil {
+				info.BitrateKbps, _ = strconv.Atoi(m[1])
+			}
+			continue
+		}
+
+		if m := reChapter.FindStringSubmatch(line); m != nil {
+			start, _ := strconv.ParseFloat(m[1], 64)
+			end, _ := strconv.ParseFloat(m[2], 64)
+			info.Chapters = append(info.Chapters, models.Chapter{StartSec: start, EndSec: end})
+			chapter = &info.Chapters[len(info.Chapters)-1]
+			continue
+		}
+		if m := reTitle.FindStringSubmatch(line); m != nil && chapter != nil && chapter.Title == "" {
+			chapter.Title = m[1]
+			continue
+		}
+
+		if m := reStream.FindStringSubmatch(line); m != nil {
+			chapter = nil
+			info.Streams = append(info.Streams, parseStreamLine(m))
+		}
+	}
+
+	if !seenInput {
+		reason := "not recognized by ffmpeg"
+		if lastLine != "" {
+			reason = lastLine
+		}
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMedia, reason)
+	}
+	return info, nil
+}
+
+func parseStreamLine(m []string) StreamInfo {
+	idx, _ := strconv.Atoi(m[1])
+	st := StreamInfo{
+		Index:    idx,
+		Type:     strings.ToLower(m[3]),
+		Language: m[2],
+	}
+	if st.Language == "und" {
+		st.Language = ""
+	}
+
+	for i, part := range splitTopLevel(m[4]) {
+		if i == 0 {
+			st.Codec, _, _ = strings.Cut(part, " ")
+			continue
+		}
+		if sm := reKbps.FindStringSubmatch(part); sm != nil {
+			st.BitrateKbps, _ = strconv.Atoi(sm[1])
+			continue
+		}
+		switch st.Type {
+		case "video":
+			if sm := reSize.FindStringSubmatch(part); sm != nil && st.Width == 0 {
+				st.Width, _ = strconv.Atoi(sm[1])
+				st.Height, _ = strconv.Atoi(sm[2])
+			} else if sm := reFPS.FindStringSubmatch(part); sm != nil {
+				st.FPS, _ = strconv.ParseFloat(sm[1], 64)
+				if sm[2] == "k" {
+					st.FPS *= 1000
+				}
+			}
+		case "audio":
+			if sm := reHz.FindStringSubmatch(part); sm != nil {
+				st.SampleRate, _ = strconv.Atoi(sm[1])
+			} else if i == 2 {
+				st.Channels = part
+			}
+		}
+	}
+	return st
+}
+
+// splitTopLevel splits on ", " but not inside parentheses or brackets,
+// e.g. "h264 (High) (avc1 / 0x31637661), yuv420p(tv, bt709), 1280x720 [SAR 1:1 DAR 16:9]".
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
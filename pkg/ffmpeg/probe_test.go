@@ -0,0 +1,103 @@
+package ffmpeg
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+)
+
+func TestParseFFmpegInfo(t *testing.T) {
+	tests := []struct {
+		file    string
+		want    *MediaInfo
+		wantErr error
+	}{
+		{
+			// the bundled nano build: no pixel format, SAR after the bitrate
+			file: "ffmpeg_nano.txt",
+			want: &MediaInfo{
+				Format:      "mov,mp4,m4a,3gp,3g2,mj2",
+				DurationSec: 9.92,
+				BitrateKbps: 335,
+				Streams: []StreamInfo{
+					{Index: 0, Type: "video", Codec: "h264", BitrateKbps: 231, Width: 320, Height: 240, FPS: 24},
+					{Index: 1, Type: "audio", Codec: "aac", BitrateKbps: 96, SampleRate: 44100, Channels: "stereo"},
+				},
+			},
+		},
+		{
+			// chapters, languages, a subtitle stream and an output section to ignore
+			file: "ffmpeg_mkv.txt",
+			want: &MediaInfo{
+				Format:      "matroska,webm",
+				DurationSec: 3723.5,
+				BitrateKbps: 2345,
+				Streams: []StreamInfo{
+					{Index: 0, Type: "video", Codec: "vp9", Width: 1920, Height: 1080, FPS: 29.97},
+					{Index: 1, Type: "audio", Codec: "opus", Language: "eng", SampleRate: 48000, Channels: "5.1(side)"},
+					{Index: 2, Type: "subtitle", Codec: "subrip", Language: "ger"},
+				},
+				Chapters: []models.Chapter{
+					{Title: "Intro, part 1", StartSec: 0, EndSec: 65.5},
+					{Title: "Main", StartSec: 65.5, EndSec: 3723.5},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			out, err := os.ReadFile("testdata/" + tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseFFmpegInfo(string(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("not media", func(t *testing.T) {
+		_, err := parseFFmpegInfo("page.html: Invalid data found when processing input\n")
+		if !errors.Is(err, ErrInvalidMedia) {
+			t.Errorf("err = %v, want ErrInvalidMedia", err)
+		}
+	})
+}
+
+func TestParseFFprobeInfo(t *testing.T) {
+	out, err := os.ReadFile("testdata/ffprobe.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseFFprobeInfo(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &MediaInfo{
+		Format:      "mov,mp4,m4a,3gp,3g2,mj2",
+		DurationSec: 212.091,
+		BitrateKbps: 547,
+		Streams: []StreamInfo{
+			{Index: 0, Type: "video", Codec: "h264", BitrateKbps: 412, Width: 854, Height: 480, FPS: 30000.0 / 1001},
+			{Index: 1, Type: "audio", Codec: "aac", Language: "eng", BitrateKbps: 128, SampleRate: 44100, Channels: "stereo"},
+		},
+		Chapters: []models.Chapter{
+			{Title: "Verse", StartSec: 0, EndSec: 90},
+			{Title: "Chorus", StartSec: 90, EndSec: 212.078},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	if _, err := parseFFprobeInfo([]byte("Invalid data found when processing input")); err == nil {
+		t.Error("no error for output that isn't JSON")
+	}
+}
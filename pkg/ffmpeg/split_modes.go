@@ -0,0 +1,220 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/utils"
+)
+
+// SplitOptions selects how SplitBy cuts a file. Exactly one mode should be set.
+type SplitOptions struct {
+	// MaxSize splits by size in bytes (see SplitParts).
+	MaxSize int64
+	// Every splits into parts of this many seconds.
+	Every float64
+	// At splits at the given timestamps in seconds.
+	At []float64
+	// ByChapters splits at Chapters, or at the container's own chapters if Chapters is empty.
+	ByChapters bool
+	Chapters   []models.Chapter
+	// Title names the parts "<Title> - 02.mp4" / "<Title> - 02 - <chapter>.mp4".
+	// Empty keeps the input name as the base.
+	Title string
+}
+
+// SplitBy cuts the file according to opts. Cut points snap to the nearest keyframe
+// (stream copy can't cut elsewhere), so reported Start/End may differ slightly from the request.
+// Like Split, it removes the input file once all parts are written.
+func (m *Muxer) SplitBy(inputPath string, opts SplitOptions) ([]Part, error) {
+	switch {
+	case opts.MaxSize > 0:
+		parts, err := m.SplitParts(inputPath, opts.MaxSize)
+		if err != nil || opts.Title == "" || len(parts) < 2 {
+			return parts, err
+		}
+		return renameParts(parts, filepath.Dir(inputPath), opts.Title, nil)
+
+	case opts.Every > 0:
+		media, packets, err := m.probeCuts(inputPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to probe file: %w", err)
+		}
+		var at []float64
+		for t := opts.Every; t < media.DurationSec; t += opts.Every {
+			at = append(at, t)
+		}
+		return m.splitAt(inputPath, media, packets, at, nil, opts.Title)
+
+	case len(opts.At) > 0:
+		media, packets, err := m.probeCuts(inputPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to probe file: %w", err)
+		}
+		return m.splitAt(inputPath, media, packets, opts.At, nil, opts.Title)
+
+	case opts.ByChapters:
+		media, packets, err := m.probeCuts(inputPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to probe file: %w", err)
+		}
+		chapters := opts.Chapters
+		if len(chapters) == 0 {
+			chapters = media.Chapters
+		}
+		if len(chapters) == 0 {
+			return nil, errors.New("video has no chapters")
+		}
+
+		var at []float64
+		var titles []string
+		for i, c := range chapters {
+			if i == 0 && c.StartSec > 0.5 {
+				titles = append(titles, "") // untitled part before the first chapter
+			}
+			if i > 0 || c.StartSec > 0.5 {
+				at = append(at, c.StartSec)
+			}
+			titles = append(titles, c.Title)
+		}
+		return m.splitAt(inputPath, media, packets, at, titles, opts.Title)
+	}
+	return nil, errors.New("no split mode selected")
+}
+
+// splitAt cuts the file at the given points; titles (optional) name the resulting parts in order.
+func (m *Muxer) splitAt(inputPath string, media *MediaInfo, packets []Packet, at []float64, titles []string, baseTitle string) ([]Part, error) {
+	duration := media.DurationSec
+	if duration <= 0 {
+		return nil, errors.New("failed to get duration")
+	}
+
+	var plan *cutPlan
+	if len(media.Keyframes) > 0 {
+		plan = newCutPlan(packets, media.Keyframes)
+	} else {
+		slog.Warn("Keyframes unknown, cuts will snap to keyframes chosen by ffmpeg")
+	}
+
+	// boundaries[i] is where part i starts; titles follow the parts that survive snapping
+	boundaries := []float64{0}
+	var partTitles []string
+	if len(titles) > 0 {
+		partTitles = []string{titles[0]}
+	}
+	points := append([]float64(nil), at...)
+	order := make([]int, len(points))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return points[order[a]] < points[order[b]] })
+
+	for _, i := range order {
+		t := snapToKeyframe(points[i], media.Keyframes)
+		if t <= boundaries[len(boundaries)-1]+0.1 || t >= duration-0.1 {
+			continue
+		}
+		boundaries = append(boundaries, t)
+		if i+1 < len(titles) {
+			partTitles = append(partTitles, titles[i+1])
+		}
+	}
+
+	if len(boundaries) == 1 {
+		return []Part{{Path: inputPath, Start: 0, End: duration, Size: media.SizeBytes}}, nil
+	}
+
+	var ranges []cutRange
+	for i, start := range boundaries {
+		end := duration
+		if i+1 < len(boundaries) {
+			end = boundaries[i+1]
+		}
+		if plan != nil {
+			ranges = append(ranges, plan.rangeOf(start, end))
+		} else {
+			ranges = append(ranges, cutRange{Start: start, End: end})
+		}
+	}
+
+	tempDir, err := os.MkdirTemp(filepath.Dir(inputPath), "split_temp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer func(path string) {
+		rmerr := os.RemoveAll(path)
+		if rmerr != nil {
+			slog.Error("failed to remove temp dir", "path", path, "err", rmerr)
+		}
+	}(tempDir)
+
+	parts, err := m.cutParts(inputPath, tempDir, ranges, func(cutRange, int64) []cutRange { return nil })
+	if err != nil {
+		return nil, err
+	}
+
+	if baseTitle == "" {
+		baseTitle = strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	}
+	parts, err = renameParts(parts, filepath.Dir(inputPath), baseTitle, partTitles)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = os.Remove(inputPath)
+
+	return parts, nil
+}
+
+// snapToKeyframe returns the keyframe closest to t (t itself if keyframes are unknown).
+func snapToKeyframe(t float64, keyframes []float64) float64 {
+	if len(keyframes) == 0 {
+		return t
+	}
+	i := sort.SearchFloat64s(keyframes, t)
+	best := keyframes[min(i, len(keyframes)-1)]
+	if i > 0 && math.Abs(keyframes[i-1]-t) <= math.Abs(best-t) {
+		best = keyframes[i-1]
+	}
+	return best
+}
+
+// renameParts moves parts into dir as "<title> - NN[ - <chapter>].<ext>".
+func renameParts(parts []Part, dir, title string, chapterTitles []string) ([]Part, error) {
+	if len(parts) == 0 {
+		return parts, nil
+	}
+	ext := filepath.Ext(parts[0].Path)
+
+	base := utils.SanitizeFileName(title)
+	if base == "" {
+		base = "video"
+	}
+	width := len(fmt.Sprint(len(parts)))
+	if width < 2 {
+		width = 2
+	}
+
+	for i := range parts {
+		name := fmt.Sprintf("%s - %0*d", base, width, i+1)
+		if i < len(chapterTitles) {
+			if ch := utils.SanitizeFileName(chapterTitles[i]); ch != "" {
+				name += " - " + ch
+			}
+			parts[i].Title = chapterTitles[i]
+		}
+		finalName := filepath.Join(dir, name+ext)
+		if err := os.Rename(parts[i].Path, finalName); err != nil {
+			return nil, fmt.Errorf("failed to rename final part: %w", err)
+		}
+		parts[i].Path = finalName
+	}
+	return parts, nil
+}
@@ -1,21 +1,52 @@
 package ffmpeg
 
 import (
-	"bytes"
 	"fmt"
 	"log/slog"
 	"math"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
-	"strconv"
+	"sort"
 	"strings"
 )
 
+// Part is one piece of a split file.
+type Part struct {
+	Path string
+	// Start and End are the boundaries of the part in the source file, in seconds.
+	Start float64
+	End   float64
+	Size  int64
+	// Title is the chapter title when splitting by chapters.
+	Title string
+}
+
+// cutEpsilon shifts cut points slightly past the keyframe, so float formatting
+// never makes ffmpeg seek to the previous keyframe.
+const cutEpsilon = 0.001
+
+// muxOverheadPerPacket approximates MP4 index bytes (stsz/stts/stco/ctts entries) per packet.
+const muxOverheadPerPacket = 16
+
 // Split checks the file size. If it is larger than maxSize, the file is cut into pieces.
-// It uses a recursive approach: if a part is too large, it is divided into halves.
+// It returns the paths of the parts, see SplitParts for details.
 func (m *Muxer) Split(inputPath string, maxSize int64) ([]string, error) {
+	parts, err := m.SplitParts(inputPath, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(parts))
+	for i, p := range parts {
+		paths[i] = p.Path
+	}
+	return paths, nil
+}
+
+// SplitParts cuts the file into parts not larger than maxSize.
+// Cut points are planned at keyframes from the actual packet sizes, so every part
+// starts exactly where the previous one ended and is as close to the limit as possible.
+// A part can only exceed the limit if a single keyframe interval is larger than maxSize.
+func (m *Muxer) SplitParts(inputPath string, maxSize int64) ([]Part, error) {
 	info, err := os.Stat(inputPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat file: %w", err)
@@ -23,30 +54,49 @@ func (m *Muxer) Split(inputPath string, maxSize int64) ([]string, error) {
 	fileSize := info.Size()
 
 	if fileSize <= maxSize {
-		return []string{inputPath}, nil
+		// nothing to cut; the end time is only informative, so a file without one is fine
+		part := Part{Path: inputPath, Size: fileSize}
+		if media, err := m.Probe(inputPath); err == nil {
+			part.End = media.DurationSec
+		}
+		return []Part{part}, nil
+	}
+
+	media, packets, err := m.probeCuts(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe file: %w", err)
+	}
+	durationSec := media.DurationSec
+	if durationSec <= 0 {
+		return nil, fmt.Errorf("failed to get duration")
 	}
 
 	slog.Info("File exceeds size limit, splitting...",
 		"file_size_mb", fileSize/1024/1024,
 		"limit_mb", maxSize/1024/1024)
 
-	durationSec, err := m.getDuration(inputPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get duration: %w", err)
+	var plan *cutPlan
+	if len(media.Keyframes) > 0 {
+		plan = newCutPlan(packets, media.Keyframes)
+	} else {
+		slog.Warn("Keyframes unknown, splitting by average bitrate")
 	}
 
-	bytesPerSec := float64(fileSize) / durationSec
-	chunkDuration := (float64(maxSize) * 0.9) / bytesPerSec
-
-	if chunkDuration < 10.0 {
-		chunkDuration = 10.0
+	var ranges []cutRange
+	if plan != nil {
+		ranges = plan.bySize(0, durationSec, maxSize)
+	} else {
+		bytesPerSec := float64(fileSize) / durationSec
+		chunkDuration := math.Max((float64(maxSize)*0.9)/bytesPerSec, 10.0)
+		for start := 0.0; durationSec-start > 0.1; start += chunkDuration {
+			ranges = append(ranges, cutRange{Start: start, End: math.Min(start+chunkDuration, durationSec)})
+		}
 	}
 
-	ext := filepath.Ext(inputPath)
-	baseName := strings.TrimSuffix(inputPath, ext)
-
-	tempDir := filepath.Join(filepath.Dir(inputPath), "split_temp")
-	_ = os.MkdirAll(tempDir, 0755)
+	tempDir, err := os.MkdirTemp(filepath.Dir(inputPath), "split_temp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
 	defer func(path string) {
 		rmerr := os.RemoveAll(path)
 		if rmerr != nil {
@@ -54,128 +104,190 @@ func (m *Muxer) Split(inputPath string, maxSize int64) ([]string, error) {
 		}
 	}(tempDir)
 
-	var tempFiles []string
-
-	var processSegment func(start, dur float64) error
-	processSegment = func(start, dur float64) error {
-		tmpName := filepath.Join(tempDir, fmt.Sprintf("chunk_%.2f_%.2f%s", start, dur, ext))
-
-		err := m.cutSegment(inputPath, tmpName, start, dur)
-		if err != nil {
-			return err
+	parts, err := m.cutParts(inputPath, tempDir, ranges, func(r cutRange, size int64) []cutRange {
+		if size <= maxSize {
+			return nil
 		}
-
-		stat, err := os.Stat(tmpName)
-		if err != nil {
-			return err
+		if plan != nil {
+			// the estimate was off (container overhead), plan again with a proportionally lower target
+			target := int64(float64(maxSize) * float64(maxSize) / float64(size) * 0.97)
+			return plan.bySize(r.Start, r.End, target)
 		}
-
-		if stat.Size() > maxSize && dur > 1.0 {
-			slog.Warn("Chunk too big, resplitting...", "size_mb", stat.Size()/1024/1024, "dur", dur)
-			_ = os.Remove(tmpName)
-
-			half := dur / 2
-			if err := processSegment(start, half); err != nil {
-				return err
-			}
-
-			if start+half < durationSec {
-				remDur := half
-				if start+half+remDur > durationSec {
-					remDur = durationSec - (start + half)
-				}
-				if remDur > 0 {
-					if err := processSegment(start+half, remDur); err != nil {
-						return err
-					}
-				}
-			}
+		if r.End-r.Start <= 1.0 {
 			return nil
 		}
+		half := r.Start + (r.End-r.Start)/2
+		return []cutRange{{Start: r.Start, End: half}, {Start: half, End: r.End}}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ext := filepath.Ext(inputPath)
+	baseName := strings.TrimSuffix(inputPath, ext)
+	for i := range parts {
+		finalName := fmt.Sprintf("%s_part%03d%s", baseName, i+1, ext)
 
-		tempFiles = append(tempFiles, tmpName)
-		return nil
+		err := os.Rename(parts[i].Path, finalName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rename final part: %w", err)
+		}
+		parts[i].Path = finalName
 	}
 
-	totalPartsNaive := int(math.Ceil(durationSec / chunkDuration))
+	_ = os.Remove(inputPath)
 
-	for i := 0; i < totalPartsNaive; i++ {
-		start := float64(i) * chunkDuration
-		dur := chunkDuration
+	return parts, nil
+}
 
-		if start+dur > durationSec {
-			dur = durationSec - start
-		}
+type cutRange struct {
+	Start, End float64
+	// VideoFrames is the exact number of video frames in the range (0 = unknown).
+	VideoFrames int
+}
 
-		if dur <= 0.1 {
-			break
-		}
+// cutParts cuts every range into a file in tempDir. If resplit returns sub-ranges for a cut part,
+// the part is discarded and the sub-ranges are cut instead.
+func (m *Muxer) cutParts(inputPath, tempDir string, ranges []cutRange, resplit func(r cutRange, size int64) []cutRange) ([]Part, error) {
+	ext := filepath.Ext(inputPath)
+	var parts []Part
+
+	for len(ranges) > 0 {
+		r := ranges[0]
+		ranges = ranges[1:]
 
-		if err := processSegment(start, dur); err != nil {
+		tmpName := filepath.Join(tempDir, fmt.Sprintf("chunk_%.3f_%.3f%s", r.Start, r.End, ext))
+		if err := m.cutSegment(inputPath, tmpName, r.Start, r.End, r.VideoFrames); err != nil {
 			return nil, err
 		}
-	}
-
-	var finalPaths []string
 
-	for i, tmpFile := range tempFiles {
-		finalName := fmt.Sprintf("%s_part%03d%s", baseName, i+1, ext)
-
-		err := os.Rename(tmpFile, finalName)
+		stat, err := os.Stat(tmpName)
 		if err != nil {
-			return nil, fmt.Errorf("failed to rename final part: %w", err)
+			return nil, err
 		}
 
-		finalPaths = append(finalPaths, finalName)
-	}
+		if sub := resplit(r, stat.Size()); len(sub) > 1 {
+			slog.Warn("Chunk too big, resplitting...", "size_mb", stat.Size()/1024/1024, "start", r.Start, "end", r.End)
+			_ = os.Remove(tmpName)
+			ranges = append(sub, ranges...)
+			continue
+		}
 
-	_ = os.Remove(inputPath)
+		parts = append(parts, Part{Path: tmpName, Start: r.Start, End: r.End, Size: stat.Size()})
+	}
+	return parts, nil
+}
 
-	return finalPaths, nil
+// cutPlan answers "how many bytes would the part [start, end) take" from the packet list.
+type cutPlan struct {
+	times      []float64
+	cumSize    []int64 // cumSize[i] = total size of packets[0:i]
+	videoTimes []float64
+	keyframes  []float64
 }
 
-func (m *Muxer) getDuration(path string) (float64, error) {
-	cmd := exec.Command(m.BinaryPath, "-hide_banner", "-i", path)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+func newCutPlan(packets []Packet, keyframes []float64) *cutPlan {
+	p := &cutPlan{
+		times:     make([]float64, len(packets)),
+		cumSize:   make([]int64, len(packets)+1),
+		keyframes: keyframes,
+	}
+	for i, pk := range packets {
+		p.times[i] = pk.Time
+		p.cumSize[i+1] = p.cumSize[i] + pk.Size
+		if pk.Video {
+			p.videoTimes = append(p.videoTimes, pk.Time)
+		}
+	}
+	return p
+}
 
-	_ = cmd.Run()
+// rangeOf builds a cut range and counts its video frames.
+func (p *cutPlan) rangeOf(start, end float64) cutRange {
+	from := sort.SearchFloat64s(p.videoTimes, start-cutEpsilon)
+	to := sort.SearchFloat64s(p.videoTimes, end-cutEpsilon)
+	return cutRange{Start: start, End: end, VideoFrames: to - from}
+}
 
-	output := stderr.String()
+// estimate returns the expected file size of the part [start, end).
+func (p *cutPlan) estimate(start, end float64) int64 {
+	from := sort.SearchFloat64s(p.times, start-cutEpsilon)
+	to := sort.SearchFloat64s(p.times, end-cutEpsilon)
+	const headerBytes = 32 * 1024
+	return p.cumSize[to] - p.cumSize[from] + int64(to-from)*muxOverheadPerPacket + headerBytes
+}
 
-	re := regexp.MustCompile(`Duration: (\d{2}):(\d{2}):(\d{2}\.\d{2})`)
-	matches := re.FindStringSubmatch(output)
+// bySize greedily extends each part to the furthest keyframe that keeps it within limit.
+func (p *cutPlan) bySize(start, end float64, limit int64) []cutRange {
+	var ranges []cutRange
+	cur := start
 
-	if len(matches) < 4 {
-		return 0, fmt.Errorf("duration not found in ffmpeg output")
+	for p.estimate(cur, end) > limit {
+		next := -1.0
+		for _, k := range p.keyframes {
+			if k <= cur+cutEpsilon {
+				continue
+			}
+			if k >= end-cutEpsilon {
+				break
+			}
+			if next >= 0 && p.estimate(cur, k) > limit {
+				break
+			}
+			// the first keyframe is always taken: a part can't be shorter than one keyframe interval
+			next = k
+		}
+		if next < 0 {
+			break
+		}
+		ranges = append(ranges, p.rangeOf(cur, next))
+		cur = next
 	}
-
-	hours, _ := strconv.ParseFloat(matches[1], 64)
-	mins, _ := strconv.ParseFloat(matches[2], 64)
-	secs, _ := strconv.ParseFloat(matches[3], 64)
-
-	totalSec := hours*3600 + mins*60 + secs
-	return totalSec, nil
+	return append(ranges, p.rangeOf(cur, end))
 }
 
-func (m *Muxer) cutSegment(input, output string, start, duration float64) error {
+// cutSegment copies [start, end) of input into output without re-encoding.
+// start must be a keyframe time for the cut to be exact. With stream copy ffmpeg applies -t
+// to decode timestamps, which lag behind for B-frame video, so when videoFrames is known
+// the video stream is stopped by frame count instead and never picks up the next keyframe.
+// Container tags and subtitle tracks are only kept with m.KeepTags and m.KeepSubtitles,
+// chapters never (they would point past the part).
+func (m *Muxer) cutSegment(input, output string, start, end float64, videoFrames int) error {
+	ss := start + cutEpsilon
+	if start <= 0 {
+		ss = 0
+	}
 	args := []string{
 		"-hide_banner",
-		"-ss", fmt.Sprintf("%.2f", start),
+		"-ss", fmt.Sprintf("%.3f", ss),
 		"-i", input,
-		"-t", fmt.Sprintf("%.2f", duration),
+		"-t", fmt.Sprintf("%.3f", end-cutEpsilon-ss),
+	}
+	if videoFrames > 0 {
+		args = append(args, "-frames:v", fmt.Sprint(videoFrames))
+	}
+	args = append(args,
 		"-c", "copy",
 		"-map", "0",
 		"-avoid_negative_ts", "1",
-		"-sn", "-dn",
-		"-map_metadata", "-1",
+		"-dn",
+	)
+	if !m.KeepSubtitles {
+		args = append(args, "-sn")
+	}
+	metadata := "-1"
+	if m.KeepTags {
+		metadata = "0"
+	}
+	args = append(args,
+		"-map_metadata", metadata,
 		"-map_chapters", "-1",
 		"-movflags", "faststart",
 		"-y",
 		output,
-	}
+	)
 
-	cmd := exec.Command(m.BinaryPath, args...)
+	cmd := m.command(args...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("ffmpeg error: %s, ffmpeg output: %s", err, string(out))
@@ -0,0 +1,120 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SubtitleTrack is a subtitle file (SRT or WebVTT) to add to a video.
+type SubtitleTrack struct {
+	Path string
+	// Language is a BCP-47 code; the MP4 language tag is derived from its primary subtag.
+	Language string
+}
+
+// SupportsSubtitles returns an ErrUnsupported error unless the binary can embed subtitles,
+// or with burn render them into the picture. The bundled nano build can do neither.
+func (m *Muxer) SupportsSubtitles(burn bool) error {
+	if burn {
+		return m.Require([]string{"libx264"}, []string{"subtitles"})
+	}
+	return m.Require([]string{"mov_text"}, nil)
+}
+
+// EmbedSubtitles copies input into output with the tracks added as soft (mov_text) subtitles.
+// Subtitles the input already has are dropped. Needs the mov_text encoder.
+func (m *Muxer) EmbedSubtitles(input, output string, tracks []SubtitleTrack) error {
+	if len(tracks) == 0 {
+		return errors.New("no subtitle tracks")
+	}
+	if err := m.SupportsSubtitles(false); err != nil {
+		return err
+	}
+
+	args := []string{"-hide_banner", "-i", input}
+	for _, t := range tracks {
+		args = append(args, "-i", t.Path)
+	}
+	args = append(args, "-map", "0:v?", "-map", "0:a?")
+	for i := range tracks {
+		args = append(args, "-map", fmt.Sprintf("%d:s:0", i+1))
+	}
+	args = append(args, "-c", "copy", "-c:s", "mov_text", "-dn", "-map_metadata", "0")
+	for i, t := range tracks {
+		lang, _, _ := strings.Cut(t.Language, "-")
+		if lang != "" {
+			args = append(args, fmt.Sprintf("-metadata:s:s:%d", i), "language="+strings.ToLower(lang))
+		}
+	}
+	args = append(args, "-movflags", "faststart", "-y", output)
+
+	return m.runVideo(output, m.command(args...))
+}
+
+// BurnSubtitles renders the subtitle file into the picture of input, audio is copied.
+// Needs an ffmpeg build with libx264 and the subtitles (libass) filter.
+func (m *Muxer) BurnSubtitles(input, output, subtitlePath string) error {
+	if err := m.SupportsSubtitles(true); err != nil {
+		return err
+	}
+
+	// filter arguments have their own escaping rules: run in a temp dir with a plain file name instead
+	tempDir, err := os.MkdirTemp(filepath.Dir(output), "subs_temp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	data, err := os.ReadFile(subtitlePath)
+	if err != nil {
+		return err
+	}
+	subName := "subs" + strings.ToLower(filepath.Ext(subtitlePath))
+	if err := os.WriteFile(filepath.Join(tempDir, subName), data, 0644); err != nil {
+		return err
+	}
+
+	absIn, err := filepath.Abs(input)
+	if err != nil {
+		return err
+	}
+	absOut, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+
+	cmd := m.command(
+		"-hide_banner",
+		"-i", absIn,
+		"-map", "0:v:0",
+		"-map", "0:a?",
+		"-vf", "subtitles="+subName,
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "18",
+		"-c:a", "copy",
+		"-sn", "-dn",
+		"-map_metadata", "0",
+		"-movflags", "faststart",
+		"-y",
+		absOut,
+	)
+	cmd.Dir = tempDir
+	return m.runVideo(output, cmd)
+}
+
+func (m *Muxer) runVideo(output string, cmd *exec.Cmd) error {
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg error: %s, ffmpeg output: %s", err, string(out))
+	}
+	st, sterr := os.Stat(output)
+	if sterr != nil || st.Size() == 0 {
+		return errors.New("ffmpeg produced empty file or no file")
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Tags describe the source of a file and are written into its container.
+type Tags struct {
+	Title     string
+	Channel   string
+	SourceURL string
+	VideoID   string
+	// UploadDate is "YYYY-MM-DD".
+	UploadDate string
+	// CoverArt is an image attached to audio-only outputs (ignored when the file has video).
+	CoverArt string
+}
+
+// args maps the tags to MP4 atoms ffmpeg knows: ©nam, ©ART, ©day, ©cmt and tven.
+func (t *Tags) args() []string {
+	var args []string
+	add := func(key, value string) {
+		if value != "" {
+			args = append(args, "-metadata", key+"="+value)
+		}
+	}
+	add("title", t.Title)
+	add("artist", t.Channel)
+	add("date", t.UploadDate)
+	add("comment", t.SourceURL)
+	add("episode_id", t.VideoID)
+	return args
+}
+
+// MuxWithTags is Mux that writes tags instead of stripping all metadata (nil tags strip).
+func (m *Muxer) MuxWithTags(videoPath, audioPath, outPath string, tags *Tags) error {
+	args := []string{
+		"-hide_banner",
+		"-i", videoPath,
+		"-i", audioPath,
+		"-c", "copy",
+		"-map", "0:v:0",
+		"-map", "1:a:0",
+		"-sn", "-dn",
+		"-map_metadata", "-1",
+		"-map_chapters", "-1",
+	}
+	if tags != nil {
+		args = append(args, tags.args()...)
+	}
+	args = append(args, "-movflags", "faststart", "-y", outPath)
+
+	output, err := m.command(args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg error: %s, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// Tag remuxes input into output with the tags, replacing any metadata the source had.
+// For audio-only files tags.CoverArt is attached as the cover picture.
+func (m *Muxer) Tag(input, output string, tags Tags) error {
+	args := []string{"-hide_banner", "-i", input}
+
+	cover := false
+	if tags.CoverArt != "" {
+		if media, err := m.Probe(input); err == nil && media.Video() == nil {
+			cover = true
+			args = append(args, "-i", tags.CoverArt)
+		}
+	}
+
+	args = append(args, "-map", "0", "-c", "copy", "-sn", "-dn", "-map_metadata", "-1")
+	if cover {
+		args = append(args, "-map", "1:v:0", "-disposition:v:0", "attached_pic")
+	}
+	args = append(args, tags.args()...)
+	args = append(args, "-movflags", "faststart", "-y", output)
+
+	out, err := m.command(args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg error: %s, ffmpeg output: %s", err, string(out))
+	}
+	st, sterr := os.Stat(output)
+	if sterr != nil || st.Size() == 0 {
+		return errors.New("ffmpeg produced empty file or no file")
+	}
+	return nil
+}
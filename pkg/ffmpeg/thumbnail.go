@@ -0,0 +1,72 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// SupportsFrame returns an ErrUnsupported error unless the binary can save frames as images.
+func (m *Muxer) SupportsFrame() error {
+	return m.Require([]string{"mjpeg"}, nil)
+}
+
+// SupportsContactSheet returns an ErrUnsupported error unless the binary can make contact sheets.
+func (m *Muxer) SupportsContactSheet() error {
+	return m.Require([]string{"mjpeg"}, []string{"fps", "scale", "tile"})
+}
+
+// Frame saves the video frame at the given second as a JPEG image.
+// Needs an ffmpeg build with the h264 decoder and the mjpeg encoder (the bundled nano build has neither).
+func (m *Muxer) Frame(input, output string, at float64) error {
+	if err := m.SupportsFrame(); err != nil {
+		return err
+	}
+	return m.runImage(output,
+		"-ss", fmt.Sprintf("%.3f", at),
+		"-i", input,
+		"-frames:v", "1",
+		"-q:v", "2",
+	)
+}
+
+// ContactSheet saves a cols x rows grid of frames taken evenly across the video,
+// each scaled to width pixels. Needs a full ffmpeg build, like Frame.
+func (m *Muxer) ContactSheet(input, output string, cols, rows, width int) error {
+	if err := m.SupportsContactSheet(); err != nil {
+		return err
+	}
+	media, err := m.Probe(input)
+	if err != nil {
+		return fmt.Errorf("failed to probe file: %w", err)
+	}
+	if media.DurationSec <= 0 {
+		return errors.New("failed to get duration")
+	}
+
+	// one frame from the middle of each of the cols*rows equal slices of the video
+	interval := media.DurationSec / float64(cols*rows)
+	filter := fmt.Sprintf("fps=1/%.3f,scale=%d:-2,tile=%dx%d", interval, width, cols, rows)
+	return m.runImage(output,
+		"-ss", fmt.Sprintf("%.3f", interval/2),
+		"-i", input,
+		"-vf", filter,
+		"-frames:v", "1",
+		"-q:v", "3",
+	)
+}
+
+func (m *Muxer) runImage(output string, args ...string) error {
+	args = append([]string{"-hide_banner"}, args...)
+	args = append(args, "-an", "-sn", "-dn", "-y", output)
+
+	out, err := m.command(args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg error: %s, ffmpeg output: %s", err, string(out))
+	}
+	st, sterr := os.Stat(output)
+	if sterr != nil || st.Size() == 0 {
+		return errors.New("ffmpeg produced empty file or no file")
+	}
+	return nil
+}
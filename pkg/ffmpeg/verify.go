@@ -0,0 +1,66 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+)
+
+// ErrInvalidMedia means the file is not a playable video (e.g. an HTML error page saved as .mp4).
+var ErrInvalidMedia = errors.New("invalid media file")
+
+// ErrUnsupported means the ffmpeg binary lacks an encoder or filter the operation needs.
+var ErrUnsupported = errors.New("not supported by this ffmpeg build")
+
+// Verify inspects the container with ffmpeg and rejects files without a decodable video stream.
+func (m *Muxer) Verify(path string) (*models.MediaInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() == 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidMedia)
+	}
+
+	info, err := m.Probe(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Video() == nil {
+		return nil, fmt.Errorf("%w: no video stream", ErrInvalidMedia)
+	}
+	if info.DurationSec <= 0 {
+		// some containers don't store it in the header, then the packets tell
+		if info, _, err = m.probeCuts(path); err != nil {
+			return nil, err
+		}
+	}
+	if info.DurationSec <= 0 {
+		return nil, fmt.Errorf("%w: zero duration", ErrInvalidMedia)
+	}
+	return info.Summary(), nil
+}
+
+// VerifyStream checks that a downloaded stream file holds a stream of the given type
+// ("video" or "audio"). Errors wrap ErrInvalidMedia when the file is not that kind of media.
+func (m *Muxer) VerifyStream(path, typ string) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if stat.Size() == 0 {
+		return fmt.Errorf("%w: empty %s stream", ErrInvalidMedia, typ)
+	}
+	info, err := m.Probe(path)
+	if err != nil {
+		return err
+	}
+	if info.stream(typ) == nil {
+		return fmt.Errorf("%w: no %s stream in %s", ErrInvalidMedia, typ, filepath.Base(path))
+	}
+	return nil
+}
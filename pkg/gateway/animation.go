@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/downloader"
+	"github.com/imbecility/yt-gateway/pkg/ffmpeg"
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/storage"
+)
+
+// animationRetries is how many times an oversized animation is rendered again smaller.
+const animationRetries = 3
+
+// Animate replaces a downloaded file (the local path returned by ProcessVideo) with an animated
+// GIF/WebP of the selected range and returns its path. An animation over the downloader's file
+// size cap is rendered again with a smaller width and frame rate.
+func (s *Service) Animate(path string, res *models.VideoResult, opts ffmpeg.AnimationOptions) (string, error) {
+	if err := opts.Normalize(); err != nil {
+		return "", err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	animName := fmt.Sprintf("%s_%d-%d.%s", base, int(opts.Start), int(opts.End), opts.Format)
+	animPath := filepath.Join(filepath.Dir(path), animName)
+	release, err := s.acquireJob(res)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	muxer := s.Downloader.Muxer()
+	maxSize := s.Downloader.MaxFileSize
+
+	for attempt := 0; ; attempt++ {
+		if err := muxer.Animate(path, animPath, opts); err != nil {
+			_ = os.Remove(animPath)
+			return "", fmt.Errorf("animation failed: %w", err)
+		}
+		stat, err := os.Stat(animPath)
+		if err != nil {
+			return "", err
+		}
+		if maxSize <= 0 || stat.Size() <= maxSize {
+			slog.Info("Animation created", "format", opts.Format, "width", opts.Width, "fps", opts.FPS, "size_kb", stat.Size()/1024)
+			break
+		}
+		if attempt == animationRetries || opts.Width <= 160 {
+			_ = os.Remove(animPath)
+			return "", fmt.Errorf("%w: animation is %d MB even at %dpx", downloader.ErrFileTooLarge, stat.Size()/1024/1024, opts.Width)
+		}
+		slog.Info("Animation too large, rendering smaller", "size_mb", stat.Size()/1024/1024, "limit_mb", maxSize/1024/1024)
+		opts.Width = max(160, opts.Width*3/4)
+		opts.FPS = max(5, opts.FPS*0.8)
+	}
+
+	if res != nil {
+		res.Extension = opts.Format
+		res.Media = nil
+		if info, err := muxer.Probe(animPath); err == nil {
+			res.Media = info.Summary()
+		}
+	}
+
+	if store := s.Downloader.Storage; store != nil {
+		if err := storage.PutFile(store, s.Downloader.StorageName(animPath), animPath); err != nil {
+			return "", fmt.Errorf("failed to store animation: %w", err)
+		}
+		if err := store.Delete(s.Downloader.StorageName(path)); err != nil {
+			slog.Warn("Failed to remove full video from storage", "file", s.Downloader.StorageName(path), "err", err)
+		}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove full video", "path", path, "err", err)
+	}
+	return animPath, nil
+}
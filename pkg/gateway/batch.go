@@ -0,0 +1,120 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/providers"
+	"github.com/imbecility/yt-gateway/pkg/utils"
+)
+
+// DefaultBatchWorkers is how many videos of a batch are processed at once by default.
+const DefaultBatchWorkers = 3
+
+// BatchItem is the outcome of one video of a batch.
+type BatchItem struct {
+	// Index is the position of the video in the batch, from 0.
+	Index  int
+	URL    string
+	Result *models.VideoResult
+	// Path is the local file, as returned by ProcessVideoWith.
+	Path string
+	Err  error
+}
+
+// BatchSummary counts the outcomes of a batch.
+type BatchSummary struct {
+	Total     int
+	Succeeded int
+	Failed    int
+}
+
+// Add counts item.
+func (b *BatchSummary) Add(item BatchItem) {
+	b.Total++
+	if item.Err != nil {
+		b.Failed++
+	} else {
+		b.Succeeded++
+	}
+}
+
+// ProcessBatch runs ProcessVideoWith for every URL with up to workers at once (DefaultBatchWorkers if <= 0).
+// Results are sent as they finish, a failed video doesn't stop the others. The channel is
+// closed when all are done; cancelling ctx skips the videos that haven't started yet.
+func (s *Service) ProcessBatch(ctx context.Context, urls []string, opts Options, workers int) <-chan BatchItem {
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+	out := make(chan BatchItem, len(urls))
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(urls); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				item := BatchItem{Index: i, URL: urls[i]}
+				item.Result, item.Path, item.Err = s.ProcessVideoWith(urls[i], opts)
+				if item.Err != nil {
+					slog.Warn("Batch item failed, skipping", "index", i, "url", urls[i], "err", item.Err)
+				}
+				out <- item
+			}
+		}()
+	}
+
+	go func() {
+		defer close(out)
+		for i := range urls {
+			select {
+			case next <- i:
+				continue
+			case <-ctx.Done():
+			}
+			// not started: report the rest as cancelled
+			for ; i < len(urls); i++ {
+				out <- BatchItem{Index: i, URL: urls[i], Err: ctx.Err()}
+			}
+			break
+		}
+		close(next)
+		wg.Wait()
+	}()
+	return out
+}
+
+// ResolvePlaylist reads the playlist that rawURL points to (list= parameter or a bare playlist ID).
+func (s *Service) ResolvePlaylist(rawURL string) (*providers.Playlist, error) {
+	listID := utils.ExtractPlaylistID(rawURL)
+	if listID == "" {
+		return nil, errors.New("could not extract playlist ID")
+	}
+	p, err := providers.GetPlaylist(s.Downloader.Client, listID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist %s: %w", listID, err)
+	}
+	slog.Info("Playlist resolved", "id", listID, "title", p.Title, "videos", len(p.VideoIDs))
+	if p.Truncated {
+		slog.Warn("Playlist has more videos than its page lists, only these are processed", "id", listID, "videos", len(p.VideoIDs))
+	}
+	return p, nil
+}
+
+// ProcessPlaylist resolves the playlist and processes its videos like ProcessBatch.
+func (s *Service) ProcessPlaylist(ctx context.Context, rawURL string, opts Options, workers int) (*providers.Playlist, <-chan BatchItem, error) {
+	p, err := s.ResolvePlaylist(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	urls := make([]string, len(p.VideoIDs))
+	for i, id := range p.VideoIDs {
+		urls[i] = "https://www.youtube.com/watch?v=" + id
+	}
+	return p, s.ProcessBatch(ctx, urls, opts, workers), nil
+}
@@ -2,14 +2,18 @@ package gateway
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/imbecility/yt-gateway/pkg/client"
 	"github.com/imbecility/yt-gateway/pkg/downloader"
 	"github.com/imbecility/yt-gateway/pkg/ffmpeg"
 	"github.com/imbecility/yt-gateway/pkg/logger"
 	"github.com/imbecility/yt-gateway/pkg/providers"
+	"github.com/imbecility/yt-gateway/pkg/storage"
+	"github.com/imbecility/yt-gateway/pkg/throttle"
 )
 
 // Config represents the configuration for gateway initialization.
@@ -22,14 +26,42 @@ type Config struct {
 	TimeoutSec int
 	// Debug enables verbose logging.
 	Debug bool
+	// LogOutput receives the log lines (defaults to stdout).
+	LogOutput io.Writer
 	// ShowProgress enables the progress bar in the console (for CLI usage).
 	ShowProgress bool
+	// Storage is where finished files are published (defaults to local storage in OutputDir).
+	Storage storage.Storage
+	// MaxFileMB caps the size of a single downloaded file in megabytes (0 = unlimited).
+	MaxFileMB int
+	// QuotaMB caps the total size of stored files in megabytes (0 = unlimited).
+	QuotaMB int
+	// MaxJobs limits concurrent downloads/muxes; extra requests wait in a queue (0 = unlimited).
+	MaxJobs int
+	// BandwidthKBps caps the total download speed in kilobytes per second (0 = unlimited).
+	BandwidthKBps int
+	// EmbedMetadata writes title, channel, source URL and upload date into output files.
+	EmbedMetadata bool
+	// FileNameTemplate names output files, e.g. "{title} [{id}].{ext}" (defaults to "{id}.{ext}").
+	// Fields: {id}, {title}, {channel}, {date}, {ext}; "/" creates subdirectories.
+	FileNameTemplate string
+	// MaxDurationSec rejects longer videos before downloading (0 = unlimited).
+	MaxDurationSec int
+	// MaxEstimatedMB rejects videos estimated to be larger before downloading (0 = unlimited).
+	MaxEstimatedMB int
+	// RejectLive rejects streams that are live right now.
+	RejectLive bool
+	// Providers restricts the race to these providers, by name (defaults to all of DefaultProviders).
+	Providers []string
 }
 
 // New creates a ready-to-use Service instance with all necessary dependencies.
 func New(cfg Config) (*Service, error) {
 	// Setup the logger (globally)
-	logger.SetupGlobal(cfg.Debug, false)
+	if cfg.LogOutput == nil {
+		cfg.LogOutput = os.Stdout
+	}
+	logger.SetupGlobalTo(cfg.LogOutput, cfg.Debug, false)
 
 	// Set default values
 	if cfg.OutputDir == "" {
@@ -41,6 +73,11 @@ func New(cfg Config) (*Service, error) {
 	if cfg.TimeoutSec <= 0 {
 		cfg.TimeoutSec = 60
 	}
+	if cfg.FileNameTemplate != "" {
+		if err := downloader.ValidateFileNameTemplate(cfg.FileNameTemplate); err != nil {
+			return nil, fmt.Errorf("invalid file name template: %w", err)
+		}
+	}
 
 	// Create the directory
 	absOutDir, err := filepath.Abs(cfg.OutputDir)
@@ -64,23 +101,75 @@ func New(cfg Config) (*Service, error) {
 	}
 	cfg.FFmpegPath = realFFmpegPath
 
+	// Setup storage
+	if cfg.Storage == nil {
+		local, err := storage.NewLocal(absOutDir)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Storage = local
+	}
+
 	// Register providers
-	provs := []providers.Provider{
-		&providers.YT1S{Client: httpClient},
-		&providers.LoaderDo{Client: httpClient},
-		&providers.TechTube{Client: httpClient},
-		&providers.Clipto{Client: httpClient},
-		&providers.GetSave{Client: httpClient},
+	provs, err := selectProviders(DefaultProviders(httpClient), cfg.Providers)
+	if err != nil {
+		return nil, err
 	}
 
 	// Initialize the downloader
 	dl := &downloader.Downloader{
-		Client:       httpClient,
-		FFmpegPath:   cfg.FFmpegPath,
-		OutputDir:    absOutDir,
-		ShowProgress: cfg.ShowProgress,
+		Client:           httpClient,
+		FFmpegPath:       cfg.FFmpegPath,
+		OutputDir:        absOutDir,
+		ShowProgress:     cfg.ShowProgress,
+		Storage:          cfg.Storage,
+		MaxFileSize:      int64(cfg.MaxFileMB) * 1024 * 1024,
+		Quota:            int64(cfg.QuotaMB) * 1024 * 1024,
+		Jobs:             throttle.NewSemaphore(cfg.MaxJobs),
+		Bandwidth:        throttle.NewBucket(float64(cfg.BandwidthKBps)*1024, 0),
+		EmbedMetadata:    cfg.EmbedMetadata,
+		FileNameTemplate: cfg.FileNameTemplate,
 	}
 
 	// Return the service
-	return NewService(dl, provs, cfg.TimeoutSec), nil
+	svc := NewService(dl, provs, cfg.TimeoutSec)
+	svc.Limits = Limits{
+		MaxDurationSec: float64(cfg.MaxDurationSec),
+		MaxSizeBytes:   int64(cfg.MaxEstimatedMB) * 1024 * 1024,
+		RejectLive:     cfg.RejectLive,
+	}
+	return svc, nil
+}
+
+// selectProviders keeps the providers named in names (all of them if names is empty).
+func selectProviders(all []providers.Provider, names []string) ([]providers.Provider, error) {
+	if len(names) == 0 {
+		return all, nil
+	}
+	byName := make(map[string]providers.Provider)
+	var known []string
+	for _, p := range all {
+		byName[p.Name()] = p
+		known = append(known, p.Name())
+	}
+	var selected []providers.Provider
+	for _, name := range names {
+		p, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown provider %q (available: %s)", name, strings.Join(known, ", "))
+		}
+		selected = append(selected, p)
+	}
+	return selected, nil
+}
+
+// DefaultProviders returns the built-in providers, in race order. Their names are their hosts.
+func DefaultProviders(httpClient providers.HTTPClient) []providers.Provider {
+	return []providers.Provider{
+		&providers.YT1S{Client: httpClient},
+		&providers.LoaderDo{Client: httpClient},
+		&providers.TechTube{Client: httpClient},
+		&providers.Clipto{Client: httpClient},
+		&providers.GetSave{Client: httpClient},
+	}
 }
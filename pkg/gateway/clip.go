@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/ffmpeg"
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/storage"
+)
+
+// Clip replaces a downloaded file (the local path returned by ProcessVideo) with the selected
+// time range of it and returns the path of the clip. res.Media is updated to describe the clip.
+func (s *Service) Clip(path string, res *models.VideoResult, opts ffmpeg.ClipOptions) (string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(filepath.Base(path), ext)
+	clipName := fmt.Sprintf("%s_clip_%d-%d%s", base, int(opts.Start), int(opts.End), ext)
+	clipPath := filepath.Join(filepath.Dir(path), clipName)
+
+	release, err := s.acquireJob(res)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	muxer := s.Downloader.Muxer()
+	// subtitles embedded by Subtitles stay in the clip
+	muxer.KeepSubtitles = res != nil && len(res.Subtitles) > 0
+	start, end, err := muxer.Clip(path, clipPath, opts)
+	if err != nil {
+		_ = os.Remove(clipPath)
+		return "", fmt.Errorf("clip failed: %w", err)
+	}
+	slog.Info("Clip created", "start", start, "end", end, "accurate", opts.Accurate)
+
+	info, err := muxer.Verify(clipPath)
+	if err != nil {
+		_ = os.Remove(clipPath)
+		return "", fmt.Errorf("clip verification failed: %w", err)
+	}
+	if res != nil {
+		res.Media = info
+	}
+
+	name := s.Downloader.StorageName(path)
+	busy := s.Busy != nil && s.Busy(name)
+	if store := s.Downloader.Storage; store != nil {
+		if err := storage.PutFile(store, s.Downloader.StorageName(clipPath), clipPath); err != nil {
+			return "", fmt.Errorf("failed to store clip: %w", err)
+		}
+		if busy {
+			slog.Info("Full video is being served, leaving it to the cleaner", "file", name)
+		} else if err := store.Delete(name); err != nil {
+			slog.Warn("Failed to remove full video from storage", "file", name, "err", err)
+		}
+	}
+	// kept locally, path is the file being served
+	if busy && (s.Downloader.Storage == nil || storage.IsLocal(s.Downloader.Storage)) {
+		return clipPath, nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove full video", "path", path, "err", err)
+	}
+	return clipPath, nil
+}
+
+// acquireJob takes a Jobs slot of the downloader for ffmpeg work on res, which may be nil.
+func (s *Service) acquireJob(res *models.VideoResult) (func(), error) {
+	id := ""
+	if res != nil {
+		id = res.VideoID
+	}
+	return s.Downloader.AcquireJob(id)
+}
@@ -0,0 +1,110 @@
+package gateway
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+)
+
+// Limits reject videos before anything is downloaded. Zero values disable a check.
+type Limits struct {
+	// MaxDurationSec rejects videos longer than this.
+	MaxDurationSec float64
+	// MaxSizeBytes rejects videos whose streams are estimated to be larger than this,
+	// from the provider's format info or the Content-Length of a HEAD request.
+	MaxSizeBytes int64
+	// RejectLive rejects streams that are live right now.
+	RejectLive bool
+}
+
+// Codes of LimitError, as reported to API clients.
+const (
+	LimitTooLong  = "too_long"
+	LimitTooLarge = "too_large"
+	LimitLive     = "live_stream"
+)
+
+// LimitError is returned when a video is rejected by the Limits.
+type LimitError struct {
+	// Code is LimitTooLong, LimitTooLarge or LimitLive.
+	Code   string
+	Detail string
+}
+
+func (e *LimitError) Error() string {
+	return "video rejected: " + e.Detail
+}
+
+// CheckLimits applies s.Limits to res (with its Metadata) and returns a *LimitError if
+// the video must not be downloaded. Values that can't be determined don't reject a video.
+func (s *Service) CheckLimits(res *models.VideoResult) error {
+	l := s.Limits
+	md := res.Metadata
+	if md == nil && (l.RejectLive || l.MaxDurationSec > 0) {
+		slog.Warn("No metadata, duration and live checks skipped", "id", res.VideoID)
+	}
+
+	if l.RejectLive && md != nil && md.IsLive {
+		return &LimitError{Code: LimitLive, Detail: "live streams are not accepted"}
+	}
+	if l.MaxDurationSec > 0 && md != nil && md.DurationSec > l.MaxDurationSec {
+		return &LimitError{Code: LimitTooLong, Detail: fmt.Sprintf("duration %.0fs exceeds the limit of %.0fs", md.DurationSec, l.MaxDurationSec)}
+	}
+
+	if l.MaxSizeBytes <= 0 {
+		return nil
+	}
+	size := res.SizeBytes
+	if size <= 0 {
+		size = s.estimateSize(res)
+	}
+	if size > l.MaxSizeBytes {
+		return &LimitError{Code: LimitTooLarge, Detail: fmt.Sprintf("estimated size %d MB exceeds the limit of %d MB", size/1024/1024, l.MaxSizeBytes/1024/1024)}
+	}
+	return nil
+}
+
+// estimateSize sums the Content-Length of the streams (0 if none is known).
+func (s *Service) estimateSize(res *models.VideoResult) int64 {
+	var total int64
+	for _, u := range []string{res.DownloadURL, res.AudioURL} {
+		if u == "" {
+			continue
+		}
+		n, err := s.contentLength(u)
+		if err != nil {
+			slog.Debug("Stream size unknown", "err", err)
+			continue
+		}
+		total += n
+	}
+	return total
+}
+
+func (s *Service) contentLength(url string) (int64, error) {
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.Downloader.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func(Body io.ReadCloser) {
+		bcerr := Body.Close()
+		if bcerr != nil {
+			slog.Warn("failed to close response body", "err", bcerr)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if resp.ContentLength < 0 {
+		return 0, fmt.Errorf("no content length")
+	}
+	return resp.ContentLength, nil
+}
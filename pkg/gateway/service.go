@@ -7,9 +7,11 @@ import (
 	"log/slog"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/imbecility/yt-gateway/pkg/downloader"
+	"github.com/imbecility/yt-gateway/pkg/ffmpeg"
 	"github.com/imbecility/yt-gateway/pkg/models"
 	"github.com/imbecility/yt-gateway/pkg/providers"
 	"github.com/imbecility/yt-gateway/pkg/utils"
@@ -19,6 +21,11 @@ type Service struct {
 	Providers  []providers.Provider
 	Downloader *downloader.Downloader
 	Timeout    time.Duration
+	// Limits reject videos before they are downloaded.
+	Limits Limits
+	// Busy reports whether a stored file is being served right now; Clip leaves such
+	// full videos to the cleaner instead of deleting them (nil = never busy).
+	Busy func(name string) bool
 }
 
 func NewService(dl *downloader.Downloader, provs []providers.Provider, timeoutSec int) *Service {
@@ -32,19 +39,60 @@ func NewService(dl *downloader.Downloader, provs []providers.Provider, timeoutSe
 	}
 }
 
+// Options adjust what ProcessVideoWith produces. The zero value downloads the whole video.
+type Options struct {
+	// Clip cuts the downloaded video to a time range.
+	Clip ffmpeg.ClipOptions
+	// ClipFromURL takes the Clip start and end that are not set (0) from the t=/start=/end=
+	// of the URL, so each video of a batch is cut to the range of its own link.
+	ClipFromURL bool
+	// Subtitles saves caption tracks and can embed or burn them in (nil = none).
+	// Failing to save them is logged, failing to embed or burn them in is returned.
+	Subtitles *SubtitleOptions
+	// Thumbnail produces preview images (nil = none). Failures are logged, not returned.
+	Thumbnail *ThumbnailOptions
+	// Animation replaces the video with an animated GIF/WebP (nil = keep the video).
+	// Without its own range it uses the Clip range instead of clipping.
+	Animation *ffmpeg.AnimationOptions
+}
+
 func (s *Service) ProcessVideo(rawURL string) (*models.VideoResult, string, error) {
+	return s.ProcessVideoWith(rawURL, Options{})
+}
+
+// forURL returns the options for the video at rawURL, see ClipFromURL.
+func (o Options) forURL(rawURL string) Options {
+	if !o.ClipFromURL {
+		return o
+	}
+	start, end := utils.ExtractTimeRange(rawURL)
+	if o.Clip.Start == 0 {
+		o.Clip.Start = start
+	}
+	if o.Clip.End == 0 {
+		o.Clip.End = end
+	}
+	return o
+}
+
+// ProcessVideoWith is ProcessVideo with extra processing of the downloaded file.
+func (s *Service) ProcessVideoWith(rawURL string, opts Options) (*models.VideoResult, string, error) {
 	vidID := utils.ExtractVideoID(rawURL)
 	if vidID == "" {
 		return nil, "", errors.New("could not extract video ID")
 	}
+	opts = opts.forURL(rawURL)
 
 	fullURL := "https://www.youtube.com/watch?v=" + vidID
+	// looked up once here: the downloader takes tags and file name fields from res.Metadata
+	metadata := s.FetchMetadata(vidID)
 
 	result, providerName, err := s.GetLinkWithRetries(fullURL)
 	if err != nil {
 		return nil, "", err
 	}
 	result.VideoID = vidID
+	s.ApplyMetadata(result, metadata())
 
 	if s.needsBetterTitle(result.Title) {
 		slog.Debug("Provider returned generic title, fetching metadata...", "old_title", result.Title)
@@ -62,26 +110,162 @@ func (s *Service) ProcessVideo(rawURL string) (*models.VideoResult, string, erro
 
 	slog.Info("Link acquired", "provider", providerName, "needs_muxing", result.NeedsMuxing)
 
-	finalPath, err := s.Downloader.DownloadAndMux(result)
+	if err := s.CheckLimits(result); err != nil {
+		return nil, "", err
+	}
+
+	result, finalPath, err := s.DownloadWithFallback(fullURL, result, providerName)
 	if err != nil {
 		return nil, "", fmt.Errorf("download/mux failed: %w", err)
 	}
 
+	if opts.Subtitles != nil {
+		// before clipping, so the embedded tracks are cut along with the video
+		if err := s.Subtitles(finalPath, result, *opts.Subtitles); err != nil {
+			if opts.Subtitles.Embed || opts.Subtitles.Burn {
+				return nil, "", err
+			}
+			slog.Warn("Failed to save subtitles", "err", err)
+		}
+	}
+
+	var anim ffmpeg.AnimationOptions
+	if opts.Animation != nil {
+		anim = *opts.Animation
+		if anim.Start <= 0 && anim.End <= 0 {
+			anim.Start, anim.End = opts.Clip.Start, opts.Clip.End
+		}
+	} else if !opts.Clip.IsZero() {
+		finalPath, err = s.Clip(finalPath, result, opts.Clip)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if opts.Thumbnail != nil {
+		if err := s.Thumbnail(finalPath, result, *opts.Thumbnail); err != nil {
+			slog.Warn("Failed to create preview images", "err", err)
+		}
+	}
+
+	if opts.Animation != nil {
+		finalPath, err = s.Animate(finalPath, result, anim)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
 	absPath, _ := filepath.Abs(finalPath)
 	return result, absPath, nil
 }
 
+// FetchMetadata starts looking up the video metadata in the background, so it overlaps
+// the provider race. The returned function waits for the result (nil if the lookup failed).
+func (s *Service) FetchMetadata(videoID string) func() *models.VideoMetadata {
+	ch := make(chan *models.VideoMetadata, 1)
+	go func() {
+		md, err := providers.GetVideoMetadata(s.Downloader.Client, videoID)
+		if err != nil {
+			slog.Warn("Failed to fetch metadata", "id", videoID, "err", err)
+		}
+		ch <- md
+	}()
+
+	var once sync.Once
+	var md *models.VideoMetadata
+	return func() *models.VideoMetadata {
+		once.Do(func() { md = <-ch })
+		return md
+	}
+}
+
+// NeedsMetadata reports whether the video metadata is worth its lookup (the watch page and
+// oEmbed): when the video will be downloaded and the limits, tags or file names use it, or when
+// the provider's title of res is generic. res is nil before the provider race.
+func (s *Service) NeedsMetadata(res *models.VideoResult, download bool) bool {
+	if res != nil && s.needsBetterTitle(res.Title) {
+		return true
+	}
+	if !download {
+		return false
+	}
+	tmpl := s.Downloader.FileNameTemplate
+	return s.Limits.RejectLive || s.Limits.MaxDurationSec > 0 || s.Downloader.EmbedMetadata ||
+		strings.Contains(tmpl, "{channel}") || strings.Contains(tmpl, "{date}")
+}
+
+// ApplyMetadata attaches md to res and takes the title (if the provider's is generic),
+// channel and upload date from it.
+func (s *Service) ApplyMetadata(res *models.VideoResult, md *models.VideoMetadata) {
+	if md == nil {
+		return
+	}
+	res.Metadata = md
+	if md.Title != "" && s.needsBetterTitle(res.Title) {
+		res.Title = md.Title
+	}
+	if res.Channel == "" {
+		res.Channel = md.Channel
+	}
+	if res.UploadDate == "" {
+		res.UploadDate = md.UploadDate
+	}
+}
+
+// DownloadWithFallback downloads res and, if the file fails verification,
+// races the remaining providers for another link and tries again. Each new link is
+// checked against the Limits before it is downloaded.
+func (s *Service) DownloadWithFallback(url string, res *models.VideoResult, providerName string) (*models.VideoResult, string, error) {
+	failed := make(map[string]bool)
+	for {
+		path, err := s.Downloader.DownloadAndMux(res)
+		if err == nil {
+			return res, path, nil
+		}
+		if !errors.Is(err, ffmpeg.ErrInvalidMedia) {
+			return nil, "", err
+		}
+
+		failed[providerName] = true
+		slog.Warn("Provider returned a broken file, trying another one", "provider", providerName, "err", err)
+		if len(failed) >= len(s.Providers) {
+			return nil, "", err
+		}
+
+		next, name, lerr := s.getLink(url, failed)
+		if lerr != nil {
+			return nil, "", fmt.Errorf("%w (no other provider: %v)", err, lerr)
+		}
+		next.VideoID = res.VideoID
+		next.Channel, next.UploadDate, next.Metadata = res.Channel, res.UploadDate, res.Metadata
+		if !s.needsBetterTitle(res.Title) {
+			next.Title = res.Title
+		}
+		res, providerName = next, name
+		// another provider may report other sizes, it gets checked like the first one
+		if lerr := s.CheckLimits(res); lerr != nil {
+			return nil, "", lerr
+		}
+	}
+}
+
 func (s *Service) GetLinkWithRetries(url string) (*models.VideoResult, string, error) {
+	return s.getLink(url, nil)
+}
+
+// getLink races providers (except the skipped ones) with up to 3 attempts.
+func (s *Service) getLink(url string, skip map[string]bool) (*models.VideoResult, string, error) {
 	var lastErr error
 	for attempt := 1; attempt <= 3; attempt++ {
 		slog.Info("Starting race", "attempt", attempt, "url", url)
 
 		ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
-		res, name, err := s.raceProviders(ctx, url)
+		res, name, err := s.raceProviders(ctx, url, skip)
 		cancel()
 
 		if err == nil {
 			slog.Info("Race attempt successful", "attempt", attempt, "url", url)
+			res.Provider = name
 			return res, name, nil
 		}
 
@@ -92,7 +276,7 @@ func (s *Service) GetLinkWithRetries(url string) (*models.VideoResult, string, e
 	return nil, "", fmt.Errorf("all attempts failed: %w", lastErr)
 }
 
-func (s *Service) raceProviders(ctx context.Context, url string) (*models.VideoResult, string, error) {
+func (s *Service) raceProviders(ctx context.Context, url string, skip map[string]bool) (*models.VideoResult, string, error) {
 	type raceResult struct {
 		res  *models.VideoResult
 		name string
@@ -100,8 +284,13 @@ func (s *Service) raceProviders(ctx context.Context, url string) (*models.VideoR
 	}
 
 	resultChan := make(chan raceResult, len(s.Providers))
+	totalProvs := 0
 
 	for _, p := range s.Providers {
+		if skip[p.Name()] {
+			continue
+		}
+		totalProvs++
 		go func(p providers.Provider) {
 			res, err := p.GetLink(url)
 			select {
@@ -115,7 +304,9 @@ func (s *Service) raceProviders(ctx context.Context, url string) (*models.VideoR
 	var bestFallback *raceResult
 	var timeoutCh <-chan time.Time
 	responsesCount := 0
-	totalProvs := len(s.Providers)
+	if totalProvs == 0 {
+		return nil, "", errors.New("no providers to race")
+	}
 
 	for {
 		select {
@@ -0,0 +1,47 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/imbecility/yt-gateway/pkg/ffmpeg"
+)
+
+// TestOptionsForURL checks that each video of a batch gets the range of its own link and
+// only explicitly set times apply to all of them.
+func TestOptionsForURL(t *testing.T) {
+	urls := []string{
+		"https://youtu.be/dQw4w9WgXcQ?t=90",
+		"https://www.youtube.com/watch?v=9bZkp7q19f0",
+		"https://www.youtube.com/embed/kJQP7kiw5Fk?start=10&end=20",
+	}
+	tests := []struct {
+		name string
+		opts Options
+		want []ffmpeg.ClipOptions
+	}{
+		{
+			name: "ranges from each URL",
+			opts: Options{ClipFromURL: true},
+			want: []ffmpeg.ClipOptions{{Start: 90}, {}, {Start: 10, End: 20}},
+		},
+		{
+			name: "start for the whole batch",
+			opts: Options{ClipFromURL: true, Clip: ffmpeg.ClipOptions{Start: 5, Accurate: true}},
+			want: []ffmpeg.ClipOptions{{Start: 5, Accurate: true}, {Start: 5, Accurate: true}, {Start: 5, End: 20, Accurate: true}},
+		},
+		{
+			name: "URLs ignored",
+			opts: Options{Clip: ffmpeg.ClipOptions{End: 30}},
+			want: []ffmpeg.ClipOptions{{End: 30}, {End: 30}, {End: 30}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, u := range urls {
+				if got := tt.opts.forURL(u).Clip; got != tt.want[i] {
+					t.Errorf("forURL(%q).Clip = %+v, want %+v", u, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
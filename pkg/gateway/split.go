@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/ffmpeg"
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/providers"
+	"github.com/imbecility/yt-gateway/pkg/utils"
+)
+
+// ParseSplitSpec parses a split mode given as text:
+//
+//	"50MB", "1.5GB"         - parts not larger than the size
+//	"10m", "90s", "1:30"    - parts of the given duration
+//	"at:1:30,5:00,1h2m"     - cut at the given timestamps
+//	"chapters"              - one part per chapter
+func ParseSplitSpec(spec string) (ffmpeg.SplitOptions, error) {
+	var opts ffmpeg.SplitOptions
+	s := strings.TrimSpace(spec)
+	lower := strings.ToLower(s)
+
+	switch {
+	case lower == "chapters":
+		opts.ByChapters = true
+		return opts, nil
+
+	case strings.HasPrefix(lower, "at:"):
+		for _, item := range strings.Split(s[3:], ",") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+			t, err := utils.ParseTimestamp(item)
+			if err != nil {
+				return opts, err
+			}
+			opts.At = append(opts.At, t)
+		}
+		if len(opts.At) == 0 {
+			return opts, fmt.Errorf("no timestamps in split spec %q", spec)
+		}
+		return opts, nil
+	}
+
+	for _, unit := range []struct {
+		suffix string
+		mult   float64
+	}{{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10}} {
+		if num, ok := strings.CutSuffix(lower, unit.suffix); ok {
+			v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+			if err != nil || v <= 0 {
+				return opts, fmt.Errorf("invalid size in split spec %q", spec)
+			}
+			opts.MaxSize = int64(v * unit.mult)
+			return opts, nil
+		}
+	}
+
+	d, err := utils.ParseTimestamp(s)
+	if err != nil || d <= 0 {
+		return opts, fmt.Errorf("invalid split spec %q (want size like 50MB, duration like 10m, at:<times> or chapters)", spec)
+	}
+	opts.Every = d
+	return opts, nil
+}
+
+// Split cuts a downloaded file (the local path returned by ProcessVideo) into parts.
+// Parts are named after the video title. In chapter mode the YouTube chapters are used,
+// falling back to the chapters stored in the file.
+func (s *Service) Split(path string, res *models.VideoResult, opts ffmpeg.SplitOptions) ([]ffmpeg.Part, error) {
+	if opts.Title == "" && res != nil {
+		opts.Title = res.Title
+	}
+	if opts.ByChapters && len(opts.Chapters) == 0 && res != nil && res.VideoID != "" {
+		if res.Metadata == nil {
+			md, err := providers.GetVideoMetadata(s.Downloader.Client, res.VideoID)
+			if err != nil {
+				slog.Warn("Failed to fetch chapters", "err", err)
+			}
+			res.Metadata = md
+		}
+		if res.Metadata != nil {
+			opts.Chapters = res.Metadata.Chapters
+		}
+	}
+
+	release, err := s.acquireJob(res)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	muxer := s.Downloader.Muxer()
+	// subtitles embedded by Subtitles stay in the parts
+	muxer.KeepSubtitles = res != nil && len(res.Subtitles) > 0
+	parts, err := muxer.SplitBy(path, opts)
+	if err != nil {
+		return nil, fmt.Errorf("split failed: %w", err)
+	}
+	slog.Info("File split", "parts", len(parts))
+	return parts, nil
+}
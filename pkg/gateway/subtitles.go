@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/ffmpeg"
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/providers"
+	"github.com/imbecility/yt-gateway/pkg/storage"
+	"github.com/imbecility/yt-gateway/pkg/utils"
+)
+
+// SubtitleOptions selects the caption tracks saved for a video.
+type SubtitleOptions struct {
+	// Languages in order of preference, e.g. ["en", "de"]; "en" also matches "en-US".
+	// Empty selects the first track the video has.
+	Languages []string
+	// Format of the saved files: "srt" (default) or "vtt".
+	Format string
+	// Auto allows automatically generated captions when a language has no manual track.
+	Auto bool
+	// Embed adds the saved tracks to the video as soft subtitles (mov_text).
+	Embed bool
+	// Burn renders the first saved track into the picture (re-encodes the video).
+	Burn bool
+}
+
+// ParseSubtitleLanguages splits "en,de" into languages; "any" or "" selects the first track.
+func ParseSubtitleLanguages(s string) []string {
+	var langs []string
+	for _, l := range strings.Split(s, ",") {
+		if l = strings.TrimSpace(l); l != "" && !strings.EqualFold(l, "any") {
+			langs = append(langs, l)
+		}
+	}
+	return langs
+}
+
+// Validate checks the format and fills the default.
+func (o *SubtitleOptions) Validate() error {
+	switch strings.ToLower(o.Format) {
+	case "", "srt":
+		o.Format = "srt"
+	case "vtt":
+		o.Format = "vtt"
+	default:
+		return fmt.Errorf("unknown subtitle format %q (srt, vtt)", o.Format)
+	}
+	if o.Embed && o.Burn {
+		return errors.New("subtitles can be embedded or burned in, not both")
+	}
+	return nil
+}
+
+// Subtitles saves the selected caption tracks next to the downloaded file as
+// "<name>.<lang>.srt", fills res.Subtitles and, if asked, embeds or burns them into path.
+// path may be empty when the video was not downloaded; only the files are saved then.
+func (s *Service) Subtitles(path string, res *models.VideoResult, opts SubtitleOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	if opts.Embed || opts.Burn {
+		if err := s.Downloader.Muxer().SupportsSubtitles(opts.Burn); err != nil {
+			return err
+		}
+	}
+
+	tracks, err := providers.GetCaptionTracks(s.Downloader.Client, res.VideoID)
+	if err != nil {
+		return fmt.Errorf("no subtitles: %w", err)
+	}
+	selected := selectCaptionTracks(tracks, opts.Languages, opts.Auto)
+	if len(selected) == 0 {
+		if len(opts.Languages) == 0 {
+			return errors.New("video has no manual subtitles")
+		}
+		return fmt.Errorf("no subtitles for %s", strings.Join(opts.Languages, ", "))
+	}
+
+	stem := filepath.Join(s.Downloader.OutputDir, res.VideoID)
+	if path != "" {
+		stem = strings.TrimSuffix(path, filepath.Ext(path))
+	}
+
+	var saved []ffmpeg.SubtitleTrack
+	for _, t := range selected {
+		data, format, ferr := providers.FetchCaptions(s.Downloader.Client, t)
+		if ferr != nil {
+			slog.Warn("Failed to download subtitles", "language", t.Language, "err", ferr)
+			continue
+		}
+		if format != opts.Format {
+			if cues := utils.ParseCues(data); opts.Format == "srt" {
+				data = utils.FormatSRT(cues)
+			} else {
+				data = utils.FormatVTT(cues)
+			}
+		}
+
+		subPath := fmt.Sprintf("%s.%s.%s", stem, utils.SanitizeFileName(t.Language), opts.Format)
+		if err := os.WriteFile(subPath, data, 0644); err != nil {
+			return fmt.Errorf("failed to save subtitles: %w", err)
+		}
+		if err := s.storeFile(subPath); err != nil {
+			return err
+		}
+		res.Subtitles = append(res.Subtitles, models.Subtitle{Language: t.Language, Auto: t.Auto, Path: subPath})
+		saved = append(saved, ffmpeg.SubtitleTrack{Path: subPath, Language: t.Language})
+	}
+	if len(saved) == 0 {
+		return errors.New("no subtitles could be downloaded")
+	}
+
+	if path == "" || (!opts.Embed && !opts.Burn) {
+		return nil
+	}
+
+	release, err := s.acquireJob(res)
+	if err != nil {
+		return err
+	}
+	defer release()
+	muxer := s.Downloader.Muxer()
+	tmpPath := stem + "_subs_tmp" + filepath.Ext(path)
+	if opts.Burn {
+		err = muxer.BurnSubtitles(path, tmpPath, saved[0].Path)
+	} else {
+		err = muxer.EmbedSubtitles(path, tmpPath, saved)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to add subtitles to the video: %w", err)
+	}
+
+	info, err := muxer.Verify(tmpPath)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("subtitled video verification failed: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace video: %w", err)
+	}
+	res.Media = info
+
+	if store := s.Downloader.Storage; store != nil {
+		if err := storage.PutFile(store, s.Downloader.StorageName(path), path); err != nil {
+			return fmt.Errorf("failed to store subtitled video: %w", err)
+		}
+	}
+	slog.Info("Subtitles added to the video", "tracks", len(saved), "burned", opts.Burn)
+	return nil
+}
+
+// selectCaptionTracks picks one track per wanted language, preferring manual tracks.
+// Without languages it picks the first manual track (or the first at all when auto is allowed).
+func selectCaptionTracks(tracks []models.CaptionTrack, languages []string, auto bool) []models.CaptionTrack {
+	pick := func(match func(models.CaptionTrack) bool) (models.CaptionTrack, bool) {
+		for _, manual := range []bool{true, false} {
+			if !manual && !auto {
+				break
+			}
+			for _, t := range tracks {
+				if t.Auto != manual && match(t) {
+					return t, true
+				}
+			}
+		}
+		return models.CaptionTrack{}, false
+	}
+
+	if len(languages) == 0 {
+		if t, ok := pick(func(models.CaptionTrack) bool { return true }); ok {
+			return []models.CaptionTrack{t}
+		}
+		return nil
+	}
+
+	var selected []models.CaptionTrack
+	seen := make(map[string]bool)
+	for _, lang := range languages {
+		t, ok := pick(func(t models.CaptionTrack) bool { return providers.MatchLanguage(t.Language, lang) })
+		if !ok {
+			slog.Warn("No subtitles in language", "language", lang)
+			continue
+		}
+		if !seen[t.Language] {
+			seen[t.Language] = true
+			selected = append(selected, t)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,117 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/providers"
+	"github.com/imbecility/yt-gateway/pkg/storage"
+)
+
+// ThumbnailOptions selects the preview images produced for a video.
+type ThumbnailOptions struct {
+	// FromVideo grabs the thumbnail from the downloaded file at At seconds
+	// instead of fetching it from YouTube's image CDN.
+	FromVideo bool
+	At        float64
+	// ContactSheet adds a grid of frames taken evenly across the video.
+	ContactSheet bool
+	// SheetCols and SheetRows set the grid size (defaults to 4x4).
+	SheetCols int
+	SheetRows int
+}
+
+// contactSheetTileWidth is the width of one frame in the contact sheet.
+const contactSheetTileWidth = 320
+
+// Thumbnail creates the preview images for res and fills res.ThumbnailPath/ContactSheetPath.
+// path is the downloaded file; it may be empty if the video was not downloaded,
+// then only the CDN thumbnail is available.
+// A failed frame grab falls back to the CDN and vice versa, so one broken source is not fatal.
+func (s *Service) Thumbnail(path string, res *models.VideoResult, opts ThumbnailOptions) error {
+	// images are named after the video file, or after the ID when nothing was downloaded
+	stem := filepath.Join(s.Downloader.OutputDir, res.VideoID)
+	if path != "" {
+		stem = strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	thumbPath := stem + ".jpg"
+	muxer := s.Downloader.Muxer()
+	// without a downloaded file there's nothing for ffmpeg to do
+	if path != "" {
+		release, err := s.acquireJob(res)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	fromVideo := func() error {
+		if path == "" {
+			return fmt.Errorf("video was not downloaded")
+		}
+		at := opts.At
+		if !opts.FromVideo && res.Media != nil {
+			at = res.Media.DurationSec / 10
+		}
+		return muxer.Frame(path, thumbPath, at)
+	}
+	fromCDN := func() error {
+		return providers.FetchThumbnail(s.Downloader.Client, res.VideoID, thumbPath)
+	}
+
+	first, second := fromCDN, fromVideo
+	if opts.FromVideo {
+		first, second = fromVideo, fromCDN
+	}
+	err := first()
+	if err != nil {
+		slog.Warn("Thumbnail failed, trying the other source", "from_video", opts.FromVideo, "err", err)
+		if serr := second(); serr != nil {
+			return fmt.Errorf("thumbnail failed: %w", errors.Join(err, serr))
+		}
+	}
+	if err := s.storeFile(thumbPath); err != nil {
+		return err
+	}
+	res.ThumbnailPath = thumbPath
+
+	if !opts.ContactSheet {
+		return nil
+	}
+	if path == "" {
+		return fmt.Errorf("contact sheet needs the downloaded video")
+	}
+	cols, rows := opts.SheetCols, opts.SheetRows
+	if cols <= 0 {
+		cols = 4
+	}
+	if rows <= 0 {
+		rows = 4
+	}
+	sheetPath := stem + "_sheet.jpg"
+	if err := muxer.ContactSheet(path, sheetPath, cols, rows, contactSheetTileWidth); err != nil {
+		_ = os.Remove(sheetPath)
+		return fmt.Errorf("contact sheet failed: %w", err)
+	}
+	if err := s.storeFile(sheetPath); err != nil {
+		return err
+	}
+	res.ContactSheetPath = sheetPath
+	return nil
+}
+
+// storeFile puts a derived file (image, subtitles) into storage under its output name.
+func (s *Service) storeFile(path string) error {
+	if s.Downloader.Storage == nil {
+		return nil
+	}
+	if err := storage.PutFile(s.Downloader.Storage, s.Downloader.StorageName(path), path); err != nil {
+		return fmt.Errorf("failed to store file: %w", err)
+	}
+	return nil
+}
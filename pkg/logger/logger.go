@@ -1,11 +1,17 @@
 package logger
 
 import (
+	"io"
 	"log/slog"
 	"os"
 )
 
 func SetupGlobal(debug bool, showSource bool) {
+	SetupGlobalTo(os.Stdout, debug, showSource)
+}
+
+// SetupGlobalTo is SetupGlobal writing to w instead of stdout.
+func SetupGlobalTo(w io.Writer, debug bool, showSource bool) {
 	level := slog.LevelInfo
 	if debug {
 		level = slog.LevelDebug
@@ -16,7 +22,7 @@ func SetupGlobal(debug bool, showSource bool) {
 		AddSource: showSource,
 	}
 
-	handler := slog.NewTextHandler(os.Stdout, opts)
+	handler := slog.NewTextHandler(w, opts)
 	logger := slog.New(handler)
 
 	slog.SetDefault(logger)
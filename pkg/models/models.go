@@ -7,11 +7,96 @@ type VideoResult struct {
 	NeedsMuxing bool
 	Extension   string
 	VideoID     string
+	// Provider is the name of the provider that served the link.
+	Provider string
+	// SizeBytes is the total size of the streams as reported by the provider (0 = unknown).
+	SizeBytes int64
+	// Channel and UploadDate ("YYYY-MM-DD") come from Metadata or are looked up when files are tagged.
+	Channel    string
+	UploadDate string
+	// Metadata is what YouTube says about the video (nil if it couldn't be fetched).
+	Metadata *VideoMetadata
+	// Media is filled after the file has been downloaded and verified.
+	Media *MediaInfo
+	// ThumbnailPath and ContactSheetPath are local images, filled when requested.
+	ThumbnailPath    string
+	ContactSheetPath string
+	// Subtitles are the saved caption files, filled when requested.
+	Subtitles []Subtitle
+}
+
+// VideoMetadata describes a video as YouTube presents it, known before anything is downloaded.
+type VideoMetadata struct {
+	Title        string  `json:"title,omitempty"`
+	Channel      string  `json:"channel,omitempty"`
+	ChannelURL   string  `json:"channel_url,omitempty"`
+	ThumbnailURL string  `json:"thumbnail_url,omitempty"`
+	DurationSec  float64 `json:"duration_sec,omitempty"`
+	// UploadDate is "YYYY-MM-DD".
+	UploadDate    string    `json:"upload_date,omitempty"`
+	ViewCount     int64     `json:"view_count,omitempty"`
+	IsLive        bool      `json:"is_live,omitempty"`
+	IsShort       bool      `json:"is_short,omitempty"`
+	AgeRestricted bool      `json:"age_restricted,omitempty"`
+	Chapters      []Chapter `json:"chapters,omitempty"`
+}
+
+// Format is one stream a provider offers for a video.
+type Format struct {
+	Extension string `json:"ext"`
+	Quality   string `json:"quality,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	HasVideo  bool   `json:"video"`
+	HasAudio  bool   `json:"audio"`
+	// SizeBytes is the size reported by the provider (0 = unknown).
+	SizeBytes int64  `json:"size_bytes,omitempty"`
+	URL       string `json:"url"`
+}
+
+// MediaInfo describes a downloaded file as seen by ffmpeg.
+type MediaInfo struct {
+	DurationSec float64 `json:"duration_sec"`
+	SizeBytes   int64   `json:"size_bytes"`
+	BitrateKbps int     `json:"bitrate_kbps,omitempty"`
+	VideoCodec  string  `json:"video_codec,omitempty"`
+	AudioCodec  string  `json:"audio_codec,omitempty"`
+	Width       int     `json:"width,omitempty"`
+	Height      int     `json:"height,omitempty"`
+}
+
+// CaptionTrack is a subtitle track offered for a video.
+type CaptionTrack struct {
+	// Language is a BCP-47 code such as "en" or "pt-BR".
+	Language string `json:"language"`
+	Name     string `json:"name,omitempty"`
+	// Auto marks automatically generated (speech recognition) captions.
+	Auto bool `json:"auto,omitempty"`
+	// URL serves the track; Format is "vtt" or "srt", empty for YouTube timedtext URLs (any format via fmt=).
+	URL    string `json:"-"`
+	Format string `json:"-"`
+}
+
+// Subtitle is a saved caption file.
+type Subtitle struct {
+	Language string `json:"language"`
+	Auto     bool   `json:"auto,omitempty"`
+	// Path is the local file, URL the link to download it (API only).
+	Path string `json:"-"`
+	URL  string `json:"url,omitempty"`
+}
+
+// Chapter is a named section of a video.
+type Chapter struct {
+	Title    string  `json:"title"`
+	StartSec float64 `json:"start_sec"`
+	EndSec   float64 `json:"end_sec"`
 }
 
 type APIResponse struct {
 	Success bool   `json:"success"`
 	Error   string `json:"error,omitempty"`
+	// Code - machine-readable reason of a rejected request, e.g. "too_long", "too_large", "live_stream"
+	Code    string `json:"code,omitempty"`
 	Title   string `json:"title,omitempty"`
 	VideoID string `json:"video_id,omitempty"`
 	// DirectURL - direct link to the source (if no download was required)
@@ -20,4 +105,14 @@ type APIResponse struct {
 	StreamURL string `json:"stream_url,omitempty"`
 	// LocalPath - absolute path (for local integrations)
 	LocalPath string `json:"local_path,omitempty"`
+	// Metadata - channel, duration, views, flags and chapters of the video (if it could be fetched)
+	Metadata *VideoMetadata `json:"metadata,omitempty"`
+	// Media - container info of the downloaded file (only when it was downloaded)
+	Media *MediaInfo `json:"media,omitempty"`
+	// ThumbnailURL - link to internal API to download the thumbnail
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	// ContactSheetURL - link to internal API to download the contact sheet (if requested)
+	ContactSheetURL string `json:"contact_sheet_url,omitempty"`
+	// Subtitles - caption files saved for the video (if requested)
+	Subtitles []Subtitle `json:"subtitles,omitempty"`
 }
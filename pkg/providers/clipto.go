@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
@@ -18,7 +17,23 @@ type Clipto struct {
 
 func (p *Clipto) Name() string { return "clipto.com" }
 
-func (p *Clipto) GetLink(ytURL string) (*models.VideoResult, error) {
+// cliptoMedia is one stream of a clipto response.
+type cliptoMedia struct {
+	Extension string `json:"extension"`
+	IsAudio   bool   `json:"is_audio"`
+	Url       string `json:"url"`
+	Height    int    `json:"height"`
+	Type      string `json:"type"` // "video" or "audio"
+	Quality   string `json:"quality"`
+}
+
+type cliptoResponse struct {
+	Success bool          `json:"success"`
+	Title   string        `json:"title"`
+	Medias  []cliptoMedia `json:"medias"`
+}
+
+func (p *Clipto) fetch(ytURL string) (*cliptoResponse, error) {
 	reqInit, _ := http.NewRequest("GET", "https://www.clipto.com/ru/media-downloader/youtube-downloader", nil)
 	if resp, err := p.Client.Do(reqInit); err == nil {
 		cerr := resp.Body.Close()
@@ -46,25 +61,41 @@ func (p *Clipto) GetLink(ytURL string) (*models.VideoResult, error) {
 		}
 	}(resp.Body)
 
-	var result struct {
-		Success bool   `json:"success"`
-		Title   string `json:"title"`
-		Medias  []struct {
-			Extension string `json:"extension"`
-			IsAudio   bool   `json:"is_audio"`
-			Url       string `json:"url"`
-			Height    int    `json:"height"`
-			Type      string `json:"type"` // "video" or "audio"
-			Quality   string `json:"quality"`
-		} `json:"medias"`
-	}
-
+	var result cliptoResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, err
 	}
 	if !result.Success {
 		return nil, errors.New("clipto api returned success: false")
 	}
+	return &result, nil
+}
+
+// Formats lists every stream clipto offers for the video.
+func (p *Clipto) Formats(ytURL string) ([]models.Format, error) {
+	result, err := p.fetch(ytURL)
+	if err != nil {
+		return nil, err
+	}
+	formats := make([]models.Format, 0, len(result.Medias))
+	for _, m := range result.Medias {
+		formats = append(formats, models.Format{
+			Extension: m.Extension,
+			Quality:   m.Quality,
+			Height:    m.Height,
+			HasVideo:  m.Type == "video",
+			HasAudio:  m.Type == "audio" || m.IsAudio,
+			URL:       m.Url,
+		})
+	}
+	return formats, nil
+}
+
+func (p *Clipto) GetLink(ytURL string) (*models.VideoResult, error) {
+	result, err := p.fetch(ytURL)
+	if err != nil {
+		return nil, err
+	}
 
 	var (
 		muxedUrl     string
@@ -124,9 +155,8 @@ func (p *Clipto) GetLink(ytURL string) (*models.VideoResult, error) {
 		}, nil
 	}
 
-	fmt.Println("DEBUG: Clipto available streams:")
 	for _, m := range result.Medias {
-		fmt.Printf("- Type:%s Ext:%s H:%d IsAudio:%v\n", m.Type, m.Extension, m.Height, m.IsAudio)
+		slog.Debug("Clipto stream", "type", m.Type, "ext", m.Extension, "height", m.Height, "audio", m.IsAudio)
 	}
 
 	return nil, errors.New("clipto: suitable streams not found")
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
@@ -18,7 +17,34 @@ type GetSave struct {
 
 func (p *GetSave) Name() string { return "get-save.com" }
 
-func (p *GetSave) GetLink(ytURL string) (*models.VideoResult, error) {
+// getSaveSize is one stream of a get-save response.
+type getSaveSize struct {
+	Ext        string `json:"ext"`
+	Resolution string `json:"resolution"`
+	Url        string `json:"url"`
+	Height     *int   `json:"height"`
+	Acodec     string `json:"acodec"`
+	// Filesize is exact, FilesizeApprox estimated from the bitrate; both may be missing
+	Filesize       int64 `json:"filesize"`
+	FilesizeApprox int64 `json:"filesize_approx"`
+}
+
+// size returns the best known size of the stream (0 = unknown).
+func (s *getSaveSize) size() int64 {
+	if s.Filesize > 0 {
+		return s.Filesize
+	}
+	return s.FilesizeApprox
+}
+
+type getSaveResponse struct {
+	Meta struct {
+		Title string `json:"title"`
+	} `json:"meta"`
+	Sizes []getSaveSize `json:"sizes"`
+}
+
+func (p *GetSave) fetch(ytURL string) (*getSaveResponse, error) {
 	payload := map[string]string{"url": ytURL}
 	bodyBytes, _ := json.Marshal(payload)
 
@@ -36,26 +62,48 @@ func (p *GetSave) GetLink(ytURL string) (*models.VideoResult, error) {
 		}
 	}(resp.Body)
 
-	var result struct {
-		Meta struct {
-			Title string `json:"title"`
-		} `json:"meta"`
-		Sizes []struct {
-			Ext        string `json:"ext"`
-			Resolution string `json:"resolution"`
-			Url        string `json:"url"`
-			Height     *int   `json:"height"`
-			Acodec     string `json:"acodec"`
-		} `json:"sizes"`
+	var result getSaveResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
 	}
+	return &result, nil
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+// Formats lists every stream get-save offers for the video.
+func (p *GetSave) Formats(ytURL string) ([]models.Format, error) {
+	result, err := p.fetch(ytURL)
+	if err != nil {
+		return nil, err
+	}
+	formats := make([]models.Format, 0, len(result.Sizes))
+	for _, s := range result.Sizes {
+		f := models.Format{
+			Extension: s.Ext,
+			Quality:   s.Resolution,
+			HasVideo:  s.Resolution != "audio only",
+			HasAudio:  s.Acodec != "none",
+			SizeBytes: s.size(),
+			URL:       s.Url,
+		}
+		if s.Height != nil {
+			f.Height = *s.Height
+		}
+		formats = append(formats, f)
+	}
+	return formats, nil
+}
+
+func (p *GetSave) GetLink(ytURL string) (*models.VideoResult, error) {
+	result, err := p.fetch(ytURL)
+	if err != nil {
 		return nil, err
 	}
 
 	var (
-		bestVideoUrl string
-		bestAudioUrl string
+		bestVideoUrl  string
+		bestAudioUrl  string
+		bestVideoSize int64
+		bestAudioSize int64
 	)
 
 	priorities := []int{480, 360, 720}
@@ -67,6 +115,7 @@ func (p *GetSave) GetLink(ytURL string) (*models.VideoResult, error) {
 					DownloadURL: s.Url,
 					NeedsMuxing: false,
 					Extension:   "mp4",
+					SizeBytes:   s.size(),
 				}, nil
 			}
 		}
@@ -78,6 +127,7 @@ func (p *GetSave) GetLink(ytURL string) (*models.VideoResult, error) {
 			if h >= 360 && h <= 1080 {
 				if bestVideoUrl == "" || h == 480 {
 					bestVideoUrl = s.Url
+					bestVideoSize = s.size()
 				}
 			}
 		}
@@ -87,31 +137,37 @@ func (p *GetSave) GetLink(ytURL string) (*models.VideoResult, error) {
 		if s.Resolution == "audio only" {
 			if s.Ext == "m4a" {
 				bestAudioUrl = s.Url
+				bestAudioSize = s.size()
 				break
 			}
 			if bestAudioUrl == "" {
 				bestAudioUrl = s.Url
+				bestAudioSize = s.size()
 			}
 		}
 	}
 
 	if bestVideoUrl != "" && bestAudioUrl != "" {
+		var size int64
+		if bestVideoSize > 0 && bestAudioSize > 0 {
+			size = bestVideoSize + bestAudioSize
+		}
 		return &models.VideoResult{
 			Title:       result.Meta.Title,
 			DownloadURL: bestVideoUrl,
 			AudioURL:    bestAudioUrl,
 			NeedsMuxing: true,
 			Extension:   "mp4",
+			SizeBytes:   size,
 		}, nil
 	}
 
-	fmt.Println("DEBUG: GetSave available sizes:")
 	for _, s := range result.Sizes {
 		h := -1
 		if s.Height != nil {
 			h = *s.Height
 		}
-		fmt.Printf("- Ext:%s Res:%s H:%d Acodec:%s\n", s.Ext, s.Resolution, h, s.Acodec)
+		slog.Debug("GetSave size", "ext", s.Ext, "resolution", s.Resolution, "height", h, "acodec", s.Acodec)
 	}
 
 	return nil, errors.New("no suitable streams found")
@@ -14,3 +14,9 @@ type Provider interface {
 	Name() string
 	GetLink(youtubeURL string) (*models.VideoResult, error)
 }
+
+// FormatLister is implemented by providers that can list every stream they offer,
+// not just the one GetLink picks.
+type FormatLister interface {
+	Formats(youtubeURL string) ([]models.Format, error)
+}
@@ -2,13 +2,20 @@ package providers
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
 	"io"
 	"log/slog"
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+	"github.com/imbecility/yt-gateway/pkg/utils"
 )
 
 // GetVideoTitle tries to get the exact title of the video: fast oEmbed first, then partial HTML parsing.
@@ -23,12 +30,30 @@ func GetVideoTitle(client HTTPClient, videoID string) (string, error) {
 
 // fetchOembedTitle requests official JSON for iframe-embed video
 func fetchOembedTitle(client HTTPClient, videoID string) (string, error) {
+	data, err := fetchOembed(client, videoID)
+	if err != nil {
+		return "", err
+	}
+	return data.Title, nil
+}
+
+type oembedData struct {
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	AuthorURL    string `json:"author_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	// Width and Height of the embed player: portrait for Shorts
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func fetchOembed(client HTTPClient, videoID string) (*oembedData, error) {
 	oembedURL := fmt.Sprintf("https://www.youtube.com/oembed?url=https://www.youtube.com/watch?v=%s&format=json", videoID)
 
 	req, _ := http.NewRequest("GET", oembedURL, nil)
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		bcerr := Body.Close()
@@ -38,16 +63,14 @@ func fetchOembedTitle(client HTTPClient, videoID string) (string, error) {
 	}(resp.Body)
 
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("status %d", resp.StatusCode)
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
 	}
 
-	var data struct {
-		Title string `json:"title"`
-	}
+	var data oembedData
 	if jderr := json.NewDecoder(resp.Body).Decode(&data); jderr != nil {
-		return "", jderr
+		return nil, jderr
 	}
-	return data.Title, nil
+	return &data, nil
 }
 
 // fetchScrapedTitle downloads the first 704KB of the page and looks for the <title>
@@ -93,3 +116,157 @@ func fetchScrapedTitle(client HTTPClient, videoID string) (string, error) {
 
 	return "", fmt.Errorf("title not found in first %d bytes", maxBytes)
 }
+
+// GetVideoMetadata collects what YouTube shows about a video from the player JSON of the
+// watch page, completed by oEmbed. With only one of the two sources available the result is partial;
+// an error is returned only when both fail.
+func GetVideoMetadata(client HTTPClient, videoID string) (*models.VideoMetadata, error) {
+	md := &models.VideoMetadata{}
+
+	page, perr := fetchWatchPage(client, videoID)
+	var player *playerResponse
+	if perr == nil {
+		player, perr = parsePlayerResponse(page)
+	}
+	if perr == nil {
+		player.fill(md)
+		md.AgeRestricted = md.AgeRestricted || bytes.Contains(page, []byte(`"ytAgeRestricted"`))
+	} else {
+		slog.Debug("Player JSON not available, using oEmbed only", "id", videoID, "err", perr)
+	}
+
+	// oEmbed has the channel URL in a stable form and tells portrait (Shorts) embeds apart
+	data, oerr := fetchOembed(client, videoID)
+	if oerr == nil {
+		if md.Title == "" {
+			md.Title = data.Title
+		}
+		if md.Channel == "" {
+			md.Channel = data.AuthorName
+		}
+		if data.AuthorURL != "" {
+			md.ChannelURL = data.AuthorURL
+		}
+		if md.ThumbnailURL == "" {
+			md.ThumbnailURL = data.ThumbnailURL
+		}
+		if data.Height > data.Width && (md.DurationSec == 0 || md.DurationSec <= maxShortSec) {
+			md.IsShort = true
+		}
+	} else if perr != nil {
+		return nil, errors.Join(perr, oerr)
+	}
+	return md, nil
+}
+
+// maxShortSec is the longest video YouTube accepts as a Short.
+const maxShortSec = 180
+
+// playerResponse is the part of ytInitialPlayerResponse the metadata is taken from.
+type playerResponse struct {
+	PlayabilityStatus struct {
+		Status                     string `json:"status"`
+		DesktopLegacyAgeGateReason int    `json:"desktopLegacyAgeGateReason"`
+	} `json:"playabilityStatus"`
+	VideoDetails struct {
+		Title            string `json:"title"`
+		Author           string `json:"author"`
+		ChannelID        string `json:"channelId"`
+		LengthSeconds    string `json:"lengthSeconds"`
+		ViewCount        string `json:"viewCount"`
+		ShortDescription string `json:"shortDescription"`
+		IsLive           bool   `json:"isLive"`
+		Thumbnail        struct {
+			Thumbnails []struct {
+				URL string `json:"url"`
+			} `json:"thumbnails"`
+		} `json:"thumbnail"`
+	} `json:"videoDetails"`
+	Microformat struct {
+		Renderer struct {
+			OwnerChannelName string `json:"ownerChannelName"`
+			OwnerProfileURL  string `json:"ownerProfileUrl"`
+			UploadDate       string `json:"uploadDate"`
+			PublishDate      string `json:"publishDate"`
+			IsFamilySafe     *bool  `json:"isFamilySafe"`
+			LiveBroadcast    *struct {
+				IsLiveNow bool `json:"isLiveNow"`
+			} `json:"liveBroadcastDetails"`
+		} `json:"playerMicroformatRenderer"`
+	} `json:"microformat"`
+}
+
+// parsePlayerResponse decodes the `ytInitialPlayerResponse = {...};` object of the watch page.
+func parsePlayerResponse(page []byte) (*playerResponse, error) {
+	key := []byte("ytInitialPlayerResponse = ")
+	i := bytes.Index(page, key)
+	if i < 0 {
+		return nil, fmt.Errorf("player response not found in first %d bytes", maxWatchPageBytes)
+	}
+	var p playerResponse
+	if err := json.NewDecoder(bytes.NewReader(page[i+len(key):])).Decode(&p); err != nil {
+		return nil, fmt.Errorf("failed to decode player response: %w", err)
+	}
+	return &p, nil
+}
+
+func (p *playerResponse) fill(md *models.VideoMetadata) {
+	vd, mf := &p.VideoDetails, &p.Microformat.Renderer
+
+	md.Title = vd.Title
+	md.Channel = vd.Author
+	if md.Channel == "" {
+		md.Channel = mf.OwnerChannelName
+	}
+	switch {
+	case mf.OwnerProfileURL != "":
+		md.ChannelURL = strings.Replace(mf.OwnerProfileURL, "http://", "https://", 1)
+	case vd.ChannelID != "":
+		md.ChannelURL = "https://www.youtube.com/channel/" + vd.ChannelID
+	}
+	if n := len(vd.Thumbnail.Thumbnails); n > 0 {
+		// listed from smallest to largest
+		md.ThumbnailURL = vd.Thumbnail.Thumbnails[n-1].URL
+	}
+	md.DurationSec, _ = strconv.ParseFloat(vd.LengthSeconds, 64)
+	md.ViewCount, _ = strconv.ParseInt(vd.ViewCount, 10, 64)
+	for _, date := range []string{mf.UploadDate, mf.PublishDate} {
+		if len(date) >= 10 {
+			md.UploadDate = date[:10]
+			break
+		}
+	}
+	md.IsLive = vd.IsLive || (mf.LiveBroadcast != nil && mf.LiveBroadcast.IsLiveNow)
+	md.AgeRestricted = p.PlayabilityStatus.DesktopLegacyAgeGateReason != 0 ||
+		(p.PlayabilityStatus.Status == "LOGIN_REQUIRED" && mf.IsFamilySafe != nil && !*mf.IsFamilySafe)
+	md.Chapters = utils.ParseChapters(vd.ShortDescription, md.DurationSec)
+}
+
+const maxWatchPageBytes = 4 * 1024 * 1024
+
+// fetchWatchPage downloads the start of the watch page, where the player JSON lives.
+func fetchWatchPage(client HTTPClient, videoID string) ([]byte, error) {
+	return fetchPage(client, fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoID))
+}
+
+// fetchPage downloads up to maxWatchPageBytes of a YouTube page.
+func fetchPage(client HTTPClient, u string) ([]byte, error) {
+	req, _ := http.NewRequest("GET", u, nil)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		bcerr := Body.Close()
+		if bcerr != nil {
+			slog.Warn("failed to close response body", "err", bcerr)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxWatchPageBytes))
+}
@@ -0,0 +1,89 @@
+package providers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Playlist is a playlist as listed on its YouTube page.
+type Playlist struct {
+	ID       string
+	Title    string
+	VideoIDs []string
+	// Truncated means the playlist has more videos than VideoIDs: YouTube only embeds the
+	// first ~100 in the page and loads the rest as the user scrolls.
+	Truncated bool
+}
+
+// GetPlaylist reads the videos of a playlist from its page. YouTube only embeds the first
+// ~100 entries there, longer playlists are truncated (see Playlist.Truncated). Mixes (RD...)
+// have no playlist page and are rejected.
+func GetPlaylist(client HTTPClient, listID string) (*Playlist, error) {
+	if strings.HasPrefix(listID, "RD") {
+		return nil, errors.New("mixes are generated for each viewer and can't be read as a playlist")
+	}
+	page, err := fetchPage(client, "https://www.youtube.com/playlist?list="+url.QueryEscape(listID))
+	if err != nil {
+		return nil, err
+	}
+	p, err := ParsePlaylistPage(page)
+	if err != nil {
+		return nil, err
+	}
+	p.ID = listID
+	return p, nil
+}
+
+var (
+	playlistTitleRe = regexp.MustCompile(`<meta property="og:title" content="([^"]*)"`)
+	videoIDRe       = regexp.MustCompile(`^[a-zA-Z0-9_-]{11}$`)
+)
+
+// playlistRenderer holds one entry of the playlist page.
+var playlistRenderer = []byte(`"playlistVideoRenderer":{`)
+
+// continuationKey follows the last entry of a playlist page when more can be loaded.
+var continuationKey = []byte(`"continuationItemRenderer":{`)
+
+// ParsePlaylistPage extracts the title and the video IDs, in playlist order without duplicates,
+// from the HTML of a playlist page.
+func ParsePlaylistPage(page []byte) (*Playlist, error) {
+	p := &Playlist{}
+	if m := playlistTitleRe.FindSubmatch(page); m != nil {
+		p.Title = html.UnescapeString(string(m[1]))
+	}
+
+	idKey := []byte(`"videoId":"`)
+	seen := make(map[string]bool)
+	rest := page
+	for {
+		i := bytes.Index(rest, playlistRenderer)
+		if i < 0 {
+			break
+		}
+		rest = rest[i+len(playlistRenderer):]
+		j := bytes.Index(rest, idKey)
+		if j < 0 || len(rest) < j+len(idKey)+11 {
+			break
+		}
+		id := string(rest[j+len(idKey) : j+len(idKey)+11])
+		if videoIDRe.MatchString(id) && !seen[id] {
+			seen[id] = true
+			p.VideoIDs = append(p.VideoIDs, id)
+		}
+	}
+	p.Truncated = len(p.VideoIDs) > 0 && bytes.Contains(page, continuationKey)
+
+	if len(p.VideoIDs) == 0 {
+		if bytes.Contains(page, []byte(`"alerts":`)) {
+			return nil, errors.New("playlist is private, empty or does not exist")
+		}
+		return nil, fmt.Errorf("no videos found in first %d bytes", maxWatchPageBytes)
+	}
+	return p, nil
+}
@@ -0,0 +1,89 @@
+package providers
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParsePlaylistPage(t *testing.T) {
+	saved, err := os.ReadFile("testdata/playlist.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	complete := strings.Replace(string(saved), `"continuationItemRenderer":{`, `"footer":{`, 1)
+
+	tests := []struct {
+		name      string
+		page      string
+		title     string
+		ids       []string
+		truncated bool
+		wantErr   string
+	}{
+		{
+			name:      "saved page, continued",
+			page:      string(saved),
+			title:     "Tom & Jerry 'Best of'",
+			ids:       []string{"dQw4w9WgXcQ", "9bZkp7q19f0", "kJQP7kiw5Fk"},
+			truncated: true,
+		},
+		{
+			name:  "complete playlist",
+			page:  complete,
+			title: "Tom & Jerry 'Best of'",
+			ids:   []string{"dQw4w9WgXcQ", "9bZkp7q19f0", "kJQP7kiw5Fk"},
+		},
+		{
+			name: "no title",
+			page: `{"playlistVideoRenderer":{"videoId":"dQw4w9WgXcQ"}}`,
+			ids:  []string{"dQw4w9WgXcQ"},
+		},
+		{
+			name: "malformed ID skipped",
+			page: `{"playlistVideoRenderer":{"videoId":"bad id!!!!!"}},{"playlistVideoRenderer":{"videoId":"9bZkp7q19f0"}}`,
+			ids:  []string{"9bZkp7q19f0"},
+		},
+		{
+			name:    "private playlist",
+			page:    `{"alerts":[{"alertRenderer":{"type":"ERROR"}}]}`,
+			wantErr: "private",
+		},
+		{
+			name:    "no entries",
+			page:    `<html></html>`,
+			wantErr: "no videos found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePlaylistPage([]byte(tt.page))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Title != tt.title {
+				t.Errorf("Title = %q, want %q", p.Title, tt.title)
+			}
+			if !slices.Equal(p.VideoIDs, tt.ids) {
+				t.Errorf("VideoIDs = %v, want %v", p.VideoIDs, tt.ids)
+			}
+			if p.Truncated != tt.truncated {
+				t.Errorf("Truncated = %v, want %v", p.Truncated, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestGetPlaylistMix(t *testing.T) {
+	// rejected before any request, so no client is needed
+	if _, err := GetPlaylist(nil, "RDdQw4w9WgXcQ"); err == nil || !strings.Contains(err.Error(), "mixes") {
+		t.Errorf("err = %v, want mixes rejected", err)
+	}
+}
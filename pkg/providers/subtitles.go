@@ -0,0 +1,193 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+)
+
+// maxCaptionBytes caps a downloaded caption file.
+const maxCaptionBytes = 10 * 1024 * 1024
+
+// GetCaptionTracks lists the caption tracks of a video: from the player JSON of the watch page,
+// falling back to the timedtext list endpoint (manual tracks only).
+func GetCaptionTracks(client HTTPClient, videoID string) ([]models.CaptionTrack, error) {
+	page, err := fetchWatchPage(client, videoID)
+	if err == nil {
+		tracks, perr := parseCaptionTracks(page)
+		if perr == nil {
+			return tracks, nil
+		}
+		err = perr
+	}
+	slog.Debug("Caption tracks not found in watch page, falling back to timedtext", "err", err)
+
+	tracks, terr := fetchTimedtextList(client, videoID)
+	if terr != nil {
+		return nil, errors.Join(err, terr)
+	}
+	return tracks, nil
+}
+
+// parseCaptionTracks decodes the `"captionTracks":[...]` array of the player JSON.
+func parseCaptionTracks(page []byte) ([]models.CaptionTrack, error) {
+	key := []byte(`"captionTracks":`)
+	i := bytes.Index(page, key)
+	if i < 0 {
+		return nil, fmt.Errorf("no caption tracks in first %d bytes", maxWatchPageBytes)
+	}
+
+	var raw []struct {
+		BaseURL      string `json:"baseUrl"`
+		LanguageCode string `json:"languageCode"`
+		Kind         string `json:"kind"`
+		Name         struct {
+			SimpleText string `json:"simpleText"`
+			Runs       []struct {
+				Text string `json:"text"`
+			} `json:"runs"`
+		} `json:"name"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(page[i+len(key):])).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode caption tracks: %w", err)
+	}
+
+	tracks := make([]models.CaptionTrack, 0, len(raw))
+	for _, r := range raw {
+		if r.BaseURL == "" || r.LanguageCode == "" {
+			continue
+		}
+		name := r.Name.SimpleText
+		if name == "" && len(r.Name.Runs) > 0 {
+			name = r.Name.Runs[0].Text
+		}
+		tracks = append(tracks, models.CaptionTrack{
+			Language: r.LanguageCode,
+			Name:     name,
+			Auto:     r.Kind == "asr",
+			URL:      r.BaseURL,
+		})
+	}
+	if len(tracks) == 0 {
+		return nil, errors.New("video has no captions")
+	}
+	return tracks, nil
+}
+
+// fetchTimedtextList asks the timedtext endpoint for the manual caption tracks.
+func fetchTimedtextList(client HTTPClient, videoID string) ([]models.CaptionTrack, error) {
+	body, err := fetchCaptionURL(client, "https://www.youtube.com/api/timedtext?type=list&v="+url.QueryEscape(videoID))
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Tracks []struct {
+			LangCode string `xml:"lang_code,attr"`
+			Name     string `xml:"name,attr"`
+			Original string `xml:"lang_original,attr"`
+			Kind     string `xml:"kind,attr"`
+		} `xml:"track"`
+	}
+	if err := xml.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode timedtext list: %w", err)
+	}
+
+	var tracks []models.CaptionTrack
+	for _, t := range list.Tracks {
+		if t.LangCode == "" {
+			continue
+		}
+		q := url.Values{"v": {videoID}, "lang": {t.LangCode}}
+		if t.Name != "" {
+			q.Set("name", t.Name)
+		}
+		if t.Kind != "" {
+			q.Set("kind", t.Kind)
+		}
+		name := t.Original
+		if t.Name != "" {
+			name = t.Name
+		}
+		tracks = append(tracks, models.CaptionTrack{
+			Language: t.LangCode,
+			Name:     name,
+			Auto:     t.Kind == "asr",
+			URL:      "https://www.youtube.com/api/timedtext?" + q.Encode(),
+		})
+	}
+	if len(tracks) == 0 {
+		return nil, errors.New("video has no captions")
+	}
+	return tracks, nil
+}
+
+// FetchCaptions downloads a track and returns its content with the format ("vtt" or "srt").
+// YouTube timedtext tracks are requested as WebVTT.
+func FetchCaptions(client HTTPClient, track models.CaptionTrack) ([]byte, string, error) {
+	u, format := track.URL, track.Format
+	if format == "" {
+		parsed, err := url.Parse(track.URL)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid caption url: %w", err)
+		}
+		q := parsed.Query()
+		q.Set("fmt", "vtt")
+		parsed.RawQuery = q.Encode()
+		u, format = parsed.String(), "vtt"
+	}
+
+	data, err := fetchCaptionURL(client, u)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, "", errors.New("empty caption track")
+	}
+	if format == "vtt" && !bytes.HasPrefix(bytes.TrimPrefix(data, []byte("\ufeff")), []byte("WEBVTT")) {
+		return nil, "", errors.New("not a WebVTT file")
+	}
+	return data, format, nil
+}
+
+func fetchCaptionURL(client HTTPClient, u string) ([]byte, error) {
+	req, _ := http.NewRequest("GET", u, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		bcerr := Body.Close()
+		if bcerr != nil {
+			slog.Warn("failed to close response body", "err", bcerr)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCaptionBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxCaptionBytes {
+		return nil, errors.New("caption file too large")
+	}
+	return data, nil
+}
+
+// MatchLanguage reports whether the track language matches want: "en" matches "en" and "en-US".
+func MatchLanguage(language, want string) bool {
+	language, want = strings.ToLower(language), strings.ToLower(want)
+	return language == want || strings.HasPrefix(language, want+"-")
+}
@@ -0,0 +1,59 @@
+package providers
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// thumbnailSizes are YouTube's CDN images from best to worst; maxres and sd are missing for some videos.
+var thumbnailSizes = []string{"maxresdefault", "sddefault", "hqdefault"}
+
+// maxThumbnailSize guards against the CDN (or a proxy) returning something that is not a thumbnail.
+const maxThumbnailSize = 5 * 1024 * 1024
+
+// FetchThumbnail saves the best available YouTube thumbnail of the video as a JPEG at dest.
+func FetchThumbnail(client HTTPClient, videoID, dest string) error {
+	var lastErr error
+	for _, size := range thumbnailSizes {
+		u := fmt.Sprintf("https://i.ytimg.com/vi/%s/%s.jpg", videoID, size)
+		lastErr = fetchImage(client, u, dest)
+		if lastErr == nil {
+			return nil
+		}
+		slog.Debug("Thumbnail size not available", "size", size, "err", lastErr)
+	}
+	return fmt.Errorf("no thumbnail available: %w", lastErr)
+}
+
+func fetchImage(client HTTPClient, url, dest string) error {
+	req, _ := http.NewRequest("GET", url, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		bcerr := Body.Close()
+		if bcerr != nil {
+			slog.Warn("failed to close response body", "err", bcerr)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxThumbnailSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxThumbnailSize {
+		return fmt.Errorf("image too large")
+	}
+	if http.DetectContentType(data) != "image/jpeg" {
+		return fmt.Errorf("not a jpeg image")
+	}
+	return os.WriteFile(dest, data, 0644)
+}
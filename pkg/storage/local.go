@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local keeps files in a directory on the local disk.
+type Local struct {
+	Dir string
+}
+
+func NewLocal(dir string) (*Local, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage dir: %w", err)
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage dir: %w", err)
+	}
+	return &Local{Dir: abs}, nil
+}
+
+// Path resolves name (slash-separated, may contain subdirectories) inside Dir,
+// rejecting names that would escape it.
+func (l *Local) Path(name string) (string, error) {
+	if !ValidName(name) {
+		return "", fmt.Errorf("invalid file name: %q", name)
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(name)), nil
+}
+
+func (l *Local) Put(name string, r io.Reader, size int64) error {
+	path, err := l.Path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(out, r)
+	cerr := out.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("short write: %d of %d bytes", n, size)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (l *Local) Open(name string) (io.ReadSeekCloser, error) {
+	path, err := l.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (l *Local) Stat(name string) (*FileInfo, error) {
+	path, err := l.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	}
+	return &FileInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete removes the file and any directories left empty by it.
+func (l *Local) Delete(name string) error {
+	path, err := l.Path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	for dir := filepath.Dir(path); dir != l.Dir && strings.HasPrefix(dir, l.Dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break // not empty
+		}
+	}
+	return nil
+}
+
+// List returns all files, including those in subdirectories, with slash-separated names.
+func (l *Local) List() ([]FileInfo, error) {
+	var files []FileInfo
+	err := filepath.WalkDir(l.Dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if path == l.Dir {
+				return err
+			}
+			return nil // removed while walking
+		}
+		if e.IsDir() {
+			return nil
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil // removed between ReadDir and Info
+		}
+		rel, err := filepath.Rel(l.Dir, path)
+		if err != nil {
+			return nil
+		}
+		files = append(files, FileInfo{Name: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return files, err
+}
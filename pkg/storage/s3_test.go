@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "minio"
+	testSecretKey = "minio-secret"
+	testRegion    = "us-east-1"
+	testBucket    = "videos"
+)
+
+// fakeS3 is a MinIO-style stand-in: path-style addressing, SigV4 checked for every request
+// (header or presigned query), ranged GETs and ListObjectsV2 with pages of pageSize keys.
+type fakeS3 struct {
+	t        *testing.T
+	mu       sync.Mutex
+	objects  map[string][]byte
+	modified time.Time
+	pageSize int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f.verify(r); err != nil {
+		f.t.Errorf("%s %s: %v", r.Method, r.URL, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+testBucket+"/")
+	if !ok {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if key == "" && r.Method == http.MethodGet {
+		f.list(w, r.URL.Query())
+		return
+	}
+	data, exists := f.objects[key]
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if int64(len(body)) != r.ContentLength {
+			http.Error(w, "IncompleteBody", http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = body
+		return
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !exists {
+		http.Error(w, "NoSuchKey", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Last-Modified", f.modified.Format(http.TimeFormat))
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		from, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		if err != nil || from >= len(data) {
+			http.Error(w, "InvalidRange", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", from, len(data)-1, len(data)))
+		data, status = data[from:], http.StatusPartialContent
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(data)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, q url.Values) {
+	if q.Get("list-type") != "2" {
+		http.Error(w, "only ListObjectsV2", http.StatusBadRequest)
+		return
+	}
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, q.Get("prefix")) && k > q.Get("continuation-token") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	type object struct {
+		Key          string
+		LastModified string
+		Size         int
+	}
+	var page struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+		Contents              []object
+	}
+	if len(keys) > f.pageSize {
+		keys = keys[:f.pageSize]
+		page.IsTruncated, page.NextContinuationToken = true, keys[len(keys)-1]
+	}
+	for _, k := range keys {
+		page.Contents = append(page.Contents, object{k, f.modified.Format(time.RFC3339), len(f.objects[k])})
+	}
+	_ = xml.NewEncoder(w).Encode(page)
+}
+
+// verify recomputes the SigV4 signature of the request as AWS documents it.
+func (f *fakeS3) verify(r *http.Request) error {
+	q := r.URL.Query()
+	var credential, signedHeaders, signature, date, payload string
+	if q.Has("X-Amz-Signature") {
+		credential, signedHeaders = q.Get("X-Amz-Credential"), q.Get("X-Amz-SignedHeaders")
+		signature, date, payload = q.Get("X-Amz-Signature"), q.Get("X-Amz-Date"), "UNSIGNED-PAYLOAD"
+		signedAt, err := time.Parse("20060102T150405Z", date)
+		if err != nil {
+			return err
+		}
+		expires, _ := strconv.Atoi(q.Get("X-Amz-Expires"))
+		if time.Since(signedAt) > time.Duration(expires)*time.Second {
+			return errors.New("presigned URL expired")
+		}
+		q.Del("X-Amz-Signature")
+	} else {
+		auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+		if !ok {
+			return errors.New("no SigV4 authorization")
+		}
+		for _, part := range strings.Split(auth, ", ") {
+			k, v, _ := strings.Cut(part, "=")
+			switch k {
+			case "Credential":
+				credential = v
+			case "SignedHeaders":
+				signedHeaders = v
+			case "Signature":
+				signature = v
+			}
+		}
+		date, payload = r.Header.Get("X-Amz-Date"), r.Header.Get("X-Amz-Content-Sha256")
+	}
+
+	day := date[:min(8, len(date))]
+	if want := testAccessKey + "/" + day + "/" + testRegion + "/s3/aws4_request"; credential != want {
+		return fmt.Errorf("credential %q, want %q", credential, want)
+	}
+	if r.Header.Get("Range") != "" && !strings.Contains(signedHeaders, "range") {
+		return errors.New("range header not signed")
+	}
+
+	var headers strings.Builder
+	for _, h := range strings.Split(signedHeaders, ";") {
+		v := r.Header.Get(h)
+		if h == "host" {
+			v = r.Host
+		}
+		headers.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var query []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			query = append(query, awsEncode(k, true)+"="+awsEncode(v, true))
+		}
+	}
+	canonical := strings.Join([]string{
+		r.Method, awsEncode(r.URL.Path, false), strings.Join(query, "&"), headers.String(), signedHeaders, payload,
+	}, "\n")
+
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + day + "/" + testRegion + "/s3/aws4_request\n" + hex.EncodeToString(sum[:])
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range []string{day, testRegion, "s3", "aws4_request", toSign} {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(part))
+		key = h.Sum(nil)
+	}
+	if hex.EncodeToString(key) != signature {
+		return fmt.Errorf("signature mismatch, canonical request:\n%s", canonical)
+	}
+	return nil
+}
+
+// awsEncode is the URI encoding of SigV4: everything but unreserved characters, and "/" in paths.
+func awsEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-_.~", c) >= 0 || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{t: t, objects: map[string][]byte{"other-app/data.bin": []byte("x")}, modified: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), pageSize: 2}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	s, err := NewS3(srv.URL, "", testBucket, testAccessKey, testSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Prefix = "gw/"
+
+	content := []byte("0123456789abcdef")
+	names := []string{"dQw4w9WgXcQ.mp4", "2024-01-02/Rick Astley/Up & Down (live) – 1+1=2.mp4", "a/b.m4a"}
+	for _, name := range names {
+		if err := s.Put(name, bytes.NewReader(content), int64(len(content))); err != nil {
+			t.Fatalf("Put(%q): %v", name, err)
+		}
+	}
+
+	info, err := s.Stat(names[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(content)) || !info.ModTime.Equal(fake.modified) {
+		t.Errorf("Stat = %+v", info)
+	}
+	if _, err := s.Stat("missing.mp4"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of a missing file: %v, want fs.ErrNotExist", err)
+	}
+
+	f, err := s.Open(names[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(10, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(f); err != nil || string(got) != "abcdef" {
+		t.Errorf("read from 10 = %q, %v", got, err)
+	}
+	if pos, _ := f.Seek(-4, io.SeekEnd); pos != 12 {
+		t.Errorf("Seek from end = %d", pos)
+	}
+	if got, err := io.ReadAll(f); err != nil || string(got) != "cdef" {
+		t.Errorf("read last 4 = %q, %v", got, err)
+	}
+	_ = f.Close()
+
+	files, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []string
+	for _, fi := range files {
+		listed = append(listed, fi.Name)
+		if fi.Size != int64(len(content)) {
+			t.Errorf("listed size of %s = %d", fi.Name, fi.Size)
+		}
+	}
+	sort.Strings(listed)
+	want := append([]string(nil), names...)
+	sort.Strings(want)
+	if strings.Join(listed, "|") != strings.Join(want, "|") {
+		t.Errorf("List = %q, want %q", listed, want)
+	}
+
+	signed, err := s.SignedURL(names[1], time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, content) {
+		t.Errorf("presigned GET = %d %q", resp.StatusCode, body)
+	}
+	if _, err := s.SignedURL(names[1], 8*24*time.Hour); err == nil {
+		t.Error("presigned URL valid for more than 7 days")
+	}
+
+	if err := s.Delete(names[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat(names[0]); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat after Delete: %v, want fs.ErrNotExist", err)
+	}
+	if _, ok := fake.objects["other-app/data.bin"]; !ok {
+		t.Error("object outside the prefix was touched")
+	}
+}
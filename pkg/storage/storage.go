@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Storage is the place where finished files are kept and served from.
+// Names are slash-separated keys relative to the backend root (e.g. "dQw4w9WgXcQ.mp4"
+// or "2024-01-02/Channel/Title.mp4").
+type Storage interface {
+	// Put stores size bytes read from r under name, replacing any existing object.
+	Put(name string, r io.Reader, size int64) error
+	// Open returns a seekable reader, so callers can serve byte ranges.
+	Open(name string) (io.ReadSeekCloser, error)
+	// Stat returns an error wrapping fs.ErrNotExist if the object is missing.
+	Stat(name string) (*FileInfo, error)
+	Delete(name string) error
+	// List returns every stored object with its modification time.
+	List() ([]FileInfo, error)
+}
+
+// Signer is implemented by backends that can hand out direct, time-limited download URLs.
+type Signer interface {
+	SignedURL(name string, ttl time.Duration) (string, error)
+}
+
+type FileInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Age returns how long ago the object was last modified.
+func (fi FileInfo) Age() time.Duration {
+	return time.Since(fi.ModTime)
+}
+
+// PutFile stores the local file at path under name.
+// For a Local backend that already holds this exact file it does nothing.
+func PutFile(s Storage, name, path string) error {
+	if l, ok := s.(*Local); ok {
+		dst, err := l.Path(name)
+		if err != nil {
+			return err
+		}
+		if src, aerr := filepath.Abs(path); aerr == nil && src == dst {
+			return nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return s.Put(name, f, info.Size())
+}
+
+// IsLocal reports whether files in s live on this machine's disk.
+func IsLocal(s Storage) bool {
+	_, ok := s.(*Local)
+	return ok
+}
+
+// ValidName reports whether name is a relative slash-separated path without "." or ".." elements.
+func ValidName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, `\`) || filepath.IsAbs(name) {
+		return false
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// tempSuffixes end the names of work files: the streams of a download before muxing,
+// a cover being embedded and an unfinished upload.
+var tempSuffixes = []string{"_vid_tmp.mp4", "_aud_tmp.m4a", "_cover_tmp.jpg", ".part"}
+
+// tempStemSuffixes end the names of the copies being tagged or given subtitles, before
+// the extension of the file they replace.
+var tempStemSuffixes = []string{"_tag_tmp", "_subs_tmp"}
+
+// IsTemp reports whether name is a work file (download or mux scratch, an unfinished
+// upload) rather than a finished one. Only the exact names the work files get match,
+// so a video titled "my_tmp_notes" is not one.
+func IsTemp(name string) bool {
+	for _, suffix := range tempSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	for _, suffix := range tempStemSuffixes {
+		if strings.HasSuffix(stem, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package throttle
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket: tokens refill at Rate per second up to Burst.
+// It is shared by everything that should fit into one budget (e.g. all downloads).
+type Bucket struct {
+	rate   float64
+	burst  float64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket returns a bucket refilling rate tokens per second, or nil (unlimited) if rate <= 0.
+// A burst <= 0 defaults to one second worth of tokens.
+func NewBucket(rate, burst float64) *Bucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	burst = max(burst, 1)
+	return &Bucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (b *Bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// Allow takes one token if available and otherwise reports how long until one is.
+func (b *Bucket) Allow() (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Wait blocks until n tokens have been taken. Requests larger than Burst are served in parts.
+func (b *Bucket) Wait(n int) {
+	if b == nil {
+		return
+	}
+	need := float64(n)
+	for need > 0 {
+		b.mu.Lock()
+		b.refill(time.Now())
+		take := min(need, b.burst)
+		b.tokens -= take
+		deficit := -b.tokens
+		b.mu.Unlock()
+
+		need -= take
+		if deficit > 0 {
+			time.Sleep(time.Duration(deficit / b.rate * float64(time.Second)))
+		}
+	}
+}
+
+// Reader limits the read rate of R to the bucket's rate (bytes per second).
+type Reader struct {
+	R      io.Reader
+	Bucket *Bucket
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.Bucket != nil && len(p) > int(r.Bucket.burst) {
+		p = p[:int(r.Bucket.burst)]
+	}
+	n, err := r.R.Read(p)
+	if n > 0 {
+		r.Bucket.Wait(n)
+	}
+	return n, err
+}
+
+// KeyedBuckets is a set of buckets with the same rate, one per key (e.g. client IP), created on demand.
+type KeyedBuckets struct {
+	rate    float64
+	burst   float64
+	mu      sync.Mutex
+	buckets map[string]*Bucket
+	pruned  time.Time
+}
+
+// NewKeyedBuckets returns buckets refilling rate tokens per second up to burst, or nil (unlimited) if rate <= 0.
+func NewKeyedBuckets(rate, burst float64) *KeyedBuckets {
+	if rate <= 0 {
+		return nil
+	}
+	return &KeyedBuckets{rate: rate, burst: burst, buckets: make(map[string]*Bucket), pruned: time.Now()}
+}
+
+// Allow takes one token from the bucket of key, see Bucket.Allow.
+func (k *KeyedBuckets) Allow(key string) (bool, time.Duration) {
+	if k == nil {
+		return true, 0
+	}
+	k.mu.Lock()
+	if time.Since(k.pruned) > time.Minute {
+		k.prune()
+	}
+	b, ok := k.buckets[key]
+	if !ok {
+		b = NewBucket(k.rate, k.burst)
+		k.buckets[key] = b
+	}
+	k.mu.Unlock()
+	return b.Allow()
+}
+
+// prune drops the buckets that refilled completely, they are no different from new ones.
+// Call with mu held.
+func (k *KeyedBuckets) prune() {
+	for key, b := range k.buckets {
+		b.mu.Lock()
+		b.refill(time.Now())
+		full := b.tokens >= b.burst
+		b.mu.Unlock()
+		if full {
+			delete(k.buckets, key)
+		}
+	}
+	k.pruned = time.Now()
+}
@@ -0,0 +1,173 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Semaphore limits how many jobs run at once; extra callers wait in Acquire.
+type Semaphore struct {
+	slots   chan struct{}
+	waiting atomic.Int64
+}
+
+func NewSemaphore(n int) *Semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return &Semaphore{slots: make(chan struct{}, n)}
+}
+
+// Acquire blocks until a slot is free or ctx is done. A nil Semaphore never blocks.
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	s.waiting.Add(1)
+	defer s.waiting.Add(-1)
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TryAcquire takes a slot only if one is free right now.
+func (s *Semaphore) TryAcquire() bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Semaphore) Release() {
+	if s == nil {
+		return
+	}
+	<-s.slots
+}
+
+// Running returns the number of held slots.
+func (s *Semaphore) Running() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.slots)
+}
+
+// Waiting returns the number of callers queued in Acquire.
+func (s *Semaphore) Waiting() int {
+	if s == nil {
+		return 0
+	}
+	return int(s.waiting.Load())
+}
+
+// KeyedLimiter is a set of semaphores, one per key (e.g. client IP), created on demand.
+type KeyedLimiter struct {
+	limit int
+	mu    sync.Mutex
+	sems  map[string]*keyedSem
+}
+
+type keyedSem struct {
+	sem  *Semaphore
+	refs int
+}
+
+func NewKeyedLimiter(limit int) *KeyedLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &KeyedLimiter{limit: limit, sems: make(map[string]*keyedSem)}
+}
+
+// Reserve takes a place in the queue of key, unless limit jobs of key run and queue more
+// wait already (queue <= 0 = unbounded). The check and the reservation are atomic, so
+// concurrent requests can't all pass the check. A nil KeyedLimiter reserves nothing.
+func (k *KeyedLimiter) Reserve(key string, queue int) (*Reservation, bool) {
+	if k == nil {
+		return nil, true
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	ks, ok := k.sems[key]
+	if !ok {
+		ks = &keyedSem{sem: NewSemaphore(k.limit)}
+		k.sems[key] = ks
+	}
+	if queue > 0 && ks.refs >= k.limit+queue {
+		return nil, false
+	}
+	ks.refs++
+	return &Reservation{k: k, key: key, ks: ks}, true
+}
+
+// Reservation is a place in the queue of a key, held until the slot taken with Acquire or
+// TryAcquire is released, or until Cancel. A nil Reservation always gets a slot.
+type Reservation struct {
+	k   *KeyedLimiter
+	key string
+	ks  *keyedSem
+}
+
+// Acquire waits for the slot. The returned release func must be called exactly once;
+// on error the reservation is given up.
+func (r *Reservation) Acquire(ctx context.Context) (func(), error) {
+	if r == nil {
+		return func() {}, nil
+	}
+	if err := r.ks.sem.Acquire(ctx); err != nil {
+		r.Cancel()
+		return nil, err
+	}
+	return r.release, nil
+}
+
+// TryAcquire takes the slot only if one is free right now; otherwise the reservation is kept.
+func (r *Reservation) TryAcquire() (func(), bool) {
+	if r == nil {
+		return func() {}, true
+	}
+	if !r.ks.sem.TryAcquire() {
+		return nil, false
+	}
+	return r.release, true
+}
+
+// Cancel gives up a reservation that won't be used.
+func (r *Reservation) Cancel() {
+	if r == nil {
+		return
+	}
+	r.k.unref(r.key)
+}
+
+func (r *Reservation) release() {
+	r.ks.sem.Release()
+	r.k.unref(r.key)
+}
+
+// unref drops idle semaphores so the map doesn't grow with every client ever seen.
+func (k *KeyedLimiter) unref(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	ks := k.sems[key]
+	ks.refs--
+	if ks.refs <= 0 {
+		delete(k.sems, key)
+	}
+}
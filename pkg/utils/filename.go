@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFileNameBytes keeps names well below the 255-byte limit of common filesystems,
+// leaving room for suffixes like " - 02" and the extension.
+const maxFileNameBytes = 180
+
+// maxPathElementBytes is the hard filesystem limit for one path element.
+const maxPathElementBytes = 255
+
+var reservedWindowsNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFileName makes s safe to use as a single path element on Windows, macOS and Linux.
+// It returns "" if nothing usable is left.
+func SanitizeFileName(s string) string {
+	return sanitize(s, maxFileNameBytes)
+}
+
+func sanitize(s string, maxBytes int) string {
+	var b strings.Builder
+	lastSpace := false
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r): // before IsControl, so tabs and newlines separate words
+			if lastSpace {
+				continue
+			}
+			r = ' '
+		case r == utf8.RuneError, unicode.IsControl(r):
+			continue
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			r = '_'
+		}
+		lastSpace = r == ' '
+		b.WriteRune(r)
+	}
+
+	name := strings.Trim(b.String(), " .")
+	for len(name) > maxBytes {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	name = strings.TrimRight(name, " .")
+
+	base, _, _ := strings.Cut(name, ".")
+	if reservedWindowsNames[strings.ToUpper(base)] {
+		name = "_" + name
+	}
+	return name
+}
+
+var templateFieldRe = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// ExpandFileNameTemplate fills "{field}" placeholders, e.g. "{date}/{channel}/{title} [{id}].{ext}".
+// Values are sanitized so they can't add directories; "/" in the template itself makes
+// subdirectories. The result is a slash-separated relative path.
+func ExpandFileNameTemplate(tmpl string, fields map[string]string) (string, error) {
+	var unknown []string
+	expanded := templateFieldRe.ReplaceAllStringFunc(tmpl, func(m string) string {
+		key := m[1 : len(m)-1]
+		value, ok := fields[key]
+		if !ok {
+			unknown = append(unknown, m)
+			return m
+		}
+		if key == "ext" {
+			return value
+		}
+		if value = SanitizeFileName(value); value == "" {
+			value = "_"
+		}
+		return value
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unknown template fields %s", strings.Join(unknown, ", "))
+	}
+
+	segments := strings.Split(strings.ReplaceAll(expanded, `\`, "/"), "/")
+	for i, seg := range segments {
+		// values are already short, only the literal text of the template is cleaned here
+		seg = sanitize(seg, maxPathElementBytes)
+		if seg == "" {
+			seg = "_"
+		}
+		segments[i] = seg
+	}
+	return strings.Join(segments, "/"), nil
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Never Gonna Give You Up", "Never Gonna Give You Up"},
+		{`AC/DC: "Back in Black" <live>?`, "AC_DC_ _Back in Black_ _live__"},
+		{"tabs\tand\n\nnewlines   collapse", "tabs and newlines collapse"},
+		{"  .hidden trailing dots... ", "hidden trailing dots"},
+		{"bell\x07 and \x00null", "bell and null"},
+		{"CON", "_CON"},
+		{"nul.txt", "_nul.txt"},
+		{"CONSOLE", "CONSOLE"},
+		{"...", ""},
+		{"Привет, мир", "Привет, мир"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeFileName(tt.in); got != tt.want {
+			t.Errorf("SanitizeFileName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	long := SanitizeFileName(strings.Repeat("é", 200))
+	if len(long) > maxFileNameBytes || !strings.HasPrefix(long, "é") || strings.ContainsRune(long, '�') {
+		t.Errorf("long name cut badly: %d bytes, %q...", len(long), long[:10])
+	}
+}
+
+func TestExpandFileNameTemplate(t *testing.T) {
+	fields := map[string]string{
+		"id":      "dQw4w9WgXcQ",
+		"title":   "Up/Down: the ../../etc story",
+		"channel": "Rick Astley",
+		"date":    "2009-10-25",
+		"ext":     "mp4",
+	}
+	tests := []struct {
+		tmpl    string
+		want    string
+		wantErr bool
+	}{
+		{tmpl: "{id}.{ext}", want: "dQw4w9WgXcQ.mp4"},
+		{tmpl: "{title} [{id}].{ext}", want: "Up_Down_ the .._.._etc story [dQw4w9WgXcQ].mp4"},
+		{tmpl: "{date}/{channel}/{title}.{ext}", want: "2009-10-25/Rick Astley/Up_Down_ the .._.._etc story.mp4"},
+		{tmpl: `videos\{id}.{ext}`, want: "videos/dQw4w9WgXcQ.mp4"},
+		{tmpl: "../{id}.{ext}", want: "_/dQw4w9WgXcQ.mp4"},
+		{tmpl: "a?b/{id}.{ext}", want: "a_b/dQw4w9WgXcQ.mp4"},
+		{tmpl: "{id} {views}.{ext}", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ExpandFileNameTemplate(tt.tmpl, fields)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ExpandFileNameTemplate(%q) = %q, want error", tt.tmpl, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ExpandFileNameTemplate(%q) = %q, %v, want %q", tt.tmpl, got, err, tt.want)
+		}
+	}
+
+	got, _ := ExpandFileNameTemplate("{title}.{ext}", map[string]string{"title": "???", "ext": "mp4"})
+	if got != "___.mp4" {
+		t.Errorf("title of only reserved characters = %q", got)
+	}
+	got, _ = ExpandFileNameTemplate("{title}.{ext}", map[string]string{"title": " .. ", "ext": "mp4"})
+	if got != "_.mp4" {
+		t.Errorf("empty title = %q, want %q", got, "_.mp4")
+	}
+}
@@ -1,25 +1,54 @@
 package utils
 
 import (
+	"net/url"
 	"regexp"
+	"strings"
 )
 
+// ExtractVideoID returns the ID of the first video linked in input, or input itself
+// if it is a bare video ID. Empty if there is none; see ExtractAll for every link.
 func ExtractVideoID(input string) string {
-	regexPattern := `(?:https?://)?(?:www\.)?(?:youtube|youtu|youtube-nocookie)\.(?:com|be)/(?:watch\?v=|embed/|v/|.+\?v=|shorts/)?([^&=%\?]{11})`
-
-	re := regexp.MustCompile(regexPattern)
-	matches := re.FindStringSubmatch(input)
+	if refs := ExtractAll(input); len(refs) > 0 {
+		return refs[0].VideoID
+	}
 
-	if len(matches) >= 2 {
-		return matches[1]
+	input = strings.TrimSpace(input)
+	if videoIDRe.MatchString(input) {
+		return input
 	}
 
-	if len(input) == 11 {
-		validIDRe := regexp.MustCompile(`^[a-zA-Z0-9_-]{11}$`)
-		if validIDRe.MatchString(input) {
-			return input
+	return ""
+}
+
+var playlistIDRe = regexp.MustCompile(`^[a-zA-Z0-9_-]{12,64}$`)
+
+// playlistPrefixes start the IDs of playlists, uploads (UU), mixes (RD) and liked videos (LL).
+var playlistPrefixes = []string{"PL", "UU", "RD", "OL", "LL", "FL"}
+
+// ExtractPlaylistID returns the playlist ID from the list= parameter of a YouTube URL,
+// or input itself if it is a bare playlist ID. Empty if there is none.
+func ExtractPlaylistID(input string) string {
+	input = strings.TrimSpace(input)
+	if u, err := url.Parse(input); err == nil && u.Host != "" {
+		if id := u.Query().Get("list"); playlistIDRe.MatchString(id) {
+			return id
+		}
+		return ""
+	}
+	if i := strings.Index(input, "list="); i >= 0 {
+		id, _, _ := strings.Cut(input[i+len("list="):], "&")
+		if playlistIDRe.MatchString(id) {
+			return id
+		}
+		return ""
+	}
+	if playlistIDRe.MatchString(input) {
+		for _, p := range playlistPrefixes {
+			if strings.HasPrefix(input, p) {
+				return input
+			}
 		}
 	}
-
 	return ""
 }
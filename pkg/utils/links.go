@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// VideoRef is a video link found in text.
+type VideoRef struct {
+	VideoID string
+	// URL is the link as written in the text.
+	URL string
+	// Start and End are the t=/start=/end= times in seconds (0 = not set).
+	Start float64
+	End   float64
+	// PlaylistID is the list= parameter, if the video was opened from a playlist.
+	PlaylistID string
+	IsShort    bool
+}
+
+// linkRe finds YouTube links on any subdomain (www., m., music.), with or without a scheme.
+// The first group keeps "notyoutube.com" from matching in the middle of a word.
+var linkRe = regexp.MustCompile(`(?i)(^|[^a-z0-9.-])((?:https?://)?(?:[a-z0-9-]+\.)*(?:youtube\.com|youtube-nocookie\.com|youtu\.be)/[^\s<>"'` + "`" + `\[\]{}|\\^]*)`)
+
+var videoIDRe = regexp.MustCompile(`^[a-zA-Z0-9_-]{11}$`)
+
+// pathPrefixes are the path forms that carry the video ID as the next segment.
+var pathPrefixes = []string{"/shorts/", "/live/", "/embed/", "/v/", "/e/"}
+
+// ExtractAll returns every distinct video linked in text, in order of first appearance.
+// Tracking parameters such as si= are ignored; playlist-only links are skipped.
+func ExtractAll(text string) []VideoRef {
+	var refs []VideoRef
+	seen := make(map[string]bool)
+	for _, m := range linkRe.FindAllStringSubmatch(text, -1) {
+		link := strings.TrimRight(m[2], ".,;:!?)")
+		ref, ok := parseVideoLink(link)
+		if !ok || seen[ref.VideoID] {
+			continue
+		}
+		seen[ref.VideoID] = true
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// parseVideoLink reads the video reference from a single YouTube link.
+func parseVideoLink(link string) (VideoRef, bool) {
+	raw := link
+	if !strings.Contains(strings.ToLower(raw), "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return VideoRef{}, false
+	}
+
+	ref := VideoRef{URL: link}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	switch {
+	case host == "youtu.be":
+		ref.VideoID, _, _ = strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	case u.Query().Get("v") != "":
+		ref.VideoID = u.Query().Get("v")
+	default:
+		for _, prefix := range pathPrefixes {
+			if rest, ok := strings.CutPrefix(u.Path, prefix); ok {
+				ref.VideoID, _, _ = strings.Cut(rest, "/")
+				ref.IsShort = prefix == "/shorts/"
+				break
+			}
+		}
+	}
+	if !videoIDRe.MatchString(ref.VideoID) {
+		return VideoRef{}, false
+	}
+
+	ref.Start, ref.End = ExtractTimeRange(raw)
+	ref.PlaylistID = ExtractPlaylistID(raw)
+	return ref, true
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtractAll(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []VideoRef
+	}{
+		{
+			name: "watch link",
+			text: "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+			want: []VideoRef{{VideoID: "dQw4w9WgXcQ", URL: "https://www.youtube.com/watch?v=dQw4w9WgXcQ"}},
+		},
+		{
+			name: "mobile subdomain",
+			text: "https://m.youtube.com/watch?v=dQw4w9WgXcQ&feature=share",
+			want: []VideoRef{{VideoID: "dQw4w9WgXcQ", URL: "https://m.youtube.com/watch?v=dQw4w9WgXcQ&feature=share"}},
+		},
+		{
+			name: "music subdomain",
+			text: "https://music.youtube.com/watch?v=dQw4w9WgXcQ",
+			want: []VideoRef{{VideoID: "dQw4w9WgXcQ", URL: "https://music.youtube.com/watch?v=dQw4w9WgXcQ"}},
+		},
+		{
+			name: "live",
+			text: "https://www.youtube.com/live/dQw4w9WgXcQ?feature=shared",
+			want: []VideoRef{{VideoID: "dQw4w9WgXcQ", URL: "https://www.youtube.com/live/dQw4w9WgXcQ?feature=shared"}},
+		},
+		{
+			name: "shorts",
+			text: "https://youtube.com/shorts/dQw4w9WgXcQ",
+			want: []VideoRef{{VideoID: "dQw4w9WgXcQ", URL: "https://youtube.com/shorts/dQw4w9WgXcQ", IsShort: true}},
+		},
+		{
+			name: "short link with si",
+			text: "https://youtu.be/dQw4w9WgXcQ?si=AbCdEfGhIjKlMnOp",
+			want: []VideoRef{{VideoID: "dQw4w9WgXcQ", URL: "https://youtu.be/dQw4w9WgXcQ?si=AbCdEfGhIjKlMnOp"}},
+		},
+		{
+			name: "t in hours minutes seconds",
+			text: "https://youtu.be/dQw4w9WgXcQ?t=1h2m3s",
+			want: []VideoRef{{VideoID: "dQw4w9WgXcQ", URL: "https://youtu.be/dQw4w9WgXcQ?t=1h2m3s", Start: 3723}},
+		},
+		{
+			name: "t in seconds after si",
+			text: "https://youtu.be/dQw4w9WgXcQ?si=AbCdEfGhIjKlMnOp&t=42",
+			want: []VideoRef{{VideoID: "dQw4w9WgXcQ", URL: "https://youtu.be/dQw4w9WgXcQ?si=AbCdEfGhIjKlMnOp&t=42", Start: 42}},
+		},
+		{
+			name: "embed start and end",
+			text: "https://www.youtube.com/embed/dQw4w9WgXcQ?start=10&end=25",
+			want: []VideoRef{{VideoID: "dQw4w9WgXcQ", URL: "https://www.youtube.com/embed/dQw4w9WgXcQ?start=10&end=25", Start: 10, End: 25}},
+		},
+		{
+			name: "video in playlist",
+			text: "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI&index=2",
+			want: []VideoRef{{
+				VideoID:    "dQw4w9WgXcQ",
+				URL:        "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI&index=2",
+				PlaylistID: "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI",
+			}},
+		},
+		{
+			name: "playlist-only link skipped",
+			text: "https://www.youtube.com/playlist?list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI",
+		},
+		{
+			name: "trailing punctuation",
+			text: "Watch this (https://youtu.be/dQw4w9WgXcQ). Or https://www.youtube.com/watch?v=9bZkp7q19f0!",
+			want: []VideoRef{
+				{VideoID: "dQw4w9WgXcQ", URL: "https://youtu.be/dQw4w9WgXcQ"},
+				{VideoID: "9bZkp7q19f0", URL: "https://www.youtube.com/watch?v=9bZkp7q19f0"},
+			},
+		},
+		{
+			name: "no scheme",
+			text: "see youtube.com/watch?v=dQw4w9WgXcQ and www.youtu.be/9bZkp7q19f0",
+			want: []VideoRef{
+				{VideoID: "dQw4w9WgXcQ", URL: "youtube.com/watch?v=dQw4w9WgXcQ"},
+				{VideoID: "9bZkp7q19f0", URL: "www.youtu.be/9bZkp7q19f0"},
+			},
+		},
+		{
+			name: "other domain",
+			text: "https://notyoutube.com/watch?v=dQw4w9WgXcQ https://youtube.com.evil.example/watch?v=9bZkp7q19f0",
+		},
+		{
+			name: "duplicates",
+			text: "https://youtu.be/dQw4w9WgXcQ https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=5 https://youtu.be/9bZkp7q19f0",
+			want: []VideoRef{
+				{VideoID: "dQw4w9WgXcQ", URL: "https://youtu.be/dQw4w9WgXcQ"},
+				{VideoID: "9bZkp7q19f0", URL: "https://youtu.be/9bZkp7q19f0"},
+			},
+		},
+		{
+			name: "invalid ID",
+			text: "https://www.youtube.com/watch?v=tooShort https://youtu.be/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractAll(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("ExtractAll(%q)\n got %+v\nwant %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExtractVideoID covers the inputs the original regexp accepted.
+func TestExtractVideoID(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"http://youtube.com/watch?v=dQw4w9WgXcQ&feature=youtu.be", "dQw4w9WgXcQ"},
+		{"www.youtube.com/watch?v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://youtu.be/dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/embed/dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ?rel=0", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/v/dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/shorts/dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/watch?feature=player_embedded&v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"  dQw4w9WgXcQ\n", "dQw4w9WgXcQ"},
+		{"check out https://youtu.be/dQw4w9WgXcQ, it's great", "dQw4w9WgXcQ"},
+		{"dQw4w9WgXc", ""},
+		{"dQw4w9WgXc!", ""},
+		{"https://example.com/watch?v=dQw4w9WgXcQ", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ExtractVideoID(tt.input); got != tt.want {
+			t.Errorf("ExtractVideoID(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestExtractPlaylistID(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"https://www.youtube.com/playlist?list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI", "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI"},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=RDdQw4w9WgXcQ", "RDdQw4w9WgXcQ"},
+		{"youtube.com/playlist?list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI&si=x", "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI"},
+		{"PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI", "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI"},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", ""},
+		{"dQw4w9WgXcQ", ""},
+		{"XXFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI", ""},
+	}
+	for _, tt := range tests {
+		if got := ExtractPlaylistID(tt.input); got != tt.want {
+			t.Errorf("ExtractPlaylistID(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Cue is one timed caption.
+type Cue struct {
+	Start, End float64
+	Text       string
+}
+
+var (
+	cueTimingRe = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})\s+-->\s+((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})`)
+	cueTagRe    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// ParseCues reads the cues of a WebVTT or SRT file. Styling tags are removed, and
+// consecutive cues repeating the same text (YouTube's rolling auto captions) are merged.
+func ParseCues(data []byte) []Cue {
+	var cues []Cue
+	var cur *Cue
+	var text []string
+
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		t := strings.TrimSpace(strings.Join(text, "\n"))
+		if t != "" {
+			if n := len(cues); n > 0 && cues[n-1].Text == t {
+				cues[n-1].End = cur.End
+			} else {
+				cur.Text = t
+				cues = append(cues, *cur)
+			}
+		}
+		cur, text = nil, nil
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if m := cueTimingRe.FindStringSubmatch(line); m != nil {
+			flush()
+			start, serr := ParseTimestamp(strings.Replace(m[1], ",", ".", 1))
+			end, eerr := ParseTimestamp(strings.Replace(m[2], ",", ".", 1))
+			if serr == nil && eerr == nil {
+				cur = &Cue{Start: start, End: end}
+			}
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if cur != nil {
+			if clean := strings.TrimSpace(cueTagRe.ReplaceAllString(line, "")); clean != "" {
+				text = append(text, clean)
+			}
+		}
+	}
+	flush()
+	return cues
+}
+
+// FormatSRT renders cues as a SubRip file.
+func FormatSRT(cues []Cue) []byte {
+	var b bytes.Buffer
+	for i, c := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, cueTime(c.Start, ","), cueTime(c.End, ","), c.Text)
+	}
+	return b.Bytes()
+}
+
+// FormatVTT renders cues as a WebVTT file.
+func FormatVTT(cues []Cue) []byte {
+	var b bytes.Buffer
+	b.WriteString("WEBVTT\n\n")
+	for _, c := range cues {
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n", cueTime(c.Start, "."), cueTime(c.End, "."), c.Text)
+	}
+	return b.Bytes()
+}
+
+// cueTime renders "HH:MM:SS<sep>mmm".
+func cueTime(sec float64, sep string) string {
+	ms := int64(sec*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/imbecility/yt-gateway/pkg/models"
+)
+
+var unitsRe = regexp.MustCompile(`^(?:(\d+(?:\.\d+)?)h)?(?:(\d+(?:\.\d+)?)m)?(?:(\d+(?:\.\d+)?)s?)?$`)
+
+// ParseTimestamp converts "90", "90.5", "1:30", "01:02:03.5", "1h2m3s" or "1m30s" into seconds.
+func ParseTimestamp(s string) (float64, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == "" {
+		return 0, fmt.Errorf("empty timestamp")
+	}
+
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		var total float64
+		for _, p := range parts {
+			v, err := strconv.ParseFloat(p, 64)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid timestamp %q", s)
+			}
+			total = total*60 + v
+		}
+		return total, nil
+	}
+
+	m := unitsRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	var total float64
+	for i, mult := range []float64{3600, 60, 1} {
+		if m[i+1] == "" {
+			continue
+		}
+		v, _ := strconv.ParseFloat(m[i+1], 64)
+		total += v * mult
+	}
+	return total, nil
+}
+
+// FormatTimestamp renders seconds as "H:MM:SS" or "M:SS".
+func FormatTimestamp(sec float64) string {
+	t := int(sec)
+	if t >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", t/3600, t%3600/60, t%60)
+	}
+	return fmt.Sprintf("%d:%02d", t/60, t%60)
+}
+
+var chapterLineRe = regexp.MustCompile(`^\s*(?:[-•*▶]\s*)?[(\[]?((?:\d{1,2}:)?\d{1,2}:\d{2})[)\]]?\s*(?:[-–—:|]\s*)?(.+?)\s*$`)
+
+// ParseChapters extracts chapters from a video description the way YouTube does:
+// lines starting with a timestamp, the first at 0:00, at least three in ascending order.
+// The last chapter ends at duration (0 if unknown).
+func ParseChapters(description string, duration float64) []models.Chapter {
+	var chapters []models.Chapter
+	for _, line := range strings.Split(description, "\n") {
+		m := chapterLineRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		start, err := ParseTimestamp(m[1])
+		if err != nil {
+			continue
+		}
+		if len(chapters) == 0 && start != 0 {
+			continue
+		}
+		if len(chapters) > 0 && start <= chapters[len(chapters)-1].StartSec {
+			continue
+		}
+		chapters = append(chapters, models.Chapter{Title: m[2], StartSec: start})
+	}
+	if len(chapters) < 3 {
+		return nil
+	}
+	for i := range chapters {
+		if i+1 < len(chapters) {
+			chapters[i].EndSec = chapters[i+1].StartSec
+		} else {
+			chapters[i].EndSec = duration
+		}
+	}
+	return chapters
+}
+
+// ExtractTimeRange reads the time range from a shared link: "t=" or "start=" is the start,
+// "end=" the end (both also in the #fragment). Missing or invalid values are 0.
+func ExtractTimeRange(rawURL string) (start, end float64) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return 0, 0
+	}
+	params := u.Query()
+	if frag, ferr := url.ParseQuery(u.Fragment); ferr == nil {
+		for k, v := range frag {
+			if !params.Has(k) {
+				params[k] = v
+			}
+		}
+	}
+
+	get := func(keys ...string) float64 {
+		for _, k := range keys {
+			if v := params.Get(k); v != "" {
+				if sec, perr := ParseTimestamp(v); perr == nil {
+					return sec
+				}
+			}
+		}
+		return 0
+	}
+	return get("start", "t"), get("end")
+}